@@ -0,0 +1,89 @@
+package arrow_flightsql
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data/sqlutil"
+)
+
+// adhocFilter is a single Grafana ad-hoc filter applied to a query.
+type adhocFilter struct {
+	Key      string `json:"key"`
+	Operator string `json:"operator"`
+	Value    string `json:"value"`
+}
+
+// adhocOperators maps Grafana ad-hoc filter operators to their SQL equivalents.
+var adhocOperators = map[string]string{
+	"=":  "=",
+	"!=": "!=",
+	"<":  "<",
+	">":  ">",
+	"<=": "<=",
+	">=": ">=",
+	"=~": "~",
+	"!~": "!~",
+}
+
+// adhocFilterClause builds a boolean SQL expression matching all filters.
+func adhocFilterClause(filters []adhocFilter) (string, error) {
+	if len(filters) == 0 {
+		return "1=1", nil
+	}
+	conditions := make([]string, 0, len(filters))
+	for _, f := range filters {
+		op, ok := adhocOperators[f.Operator]
+		if !ok {
+			return "", fmt.Errorf("unsupported ad-hoc filter operator %q", f.Operator)
+		}
+		if f.Key == "" {
+			return "", fmt.Errorf("ad-hoc filter key is required")
+		}
+		conditions = append(conditions, fmt.Sprintf("%s %s %s", quoteIdentifier(f.Key), op, quoteLiteral(f.Value)))
+	}
+	return strings.Join(conditions, " AND "), nil
+}
+
+// createMacroAdhocFilters returns a macro function expanding to the ad-hoc filter clause.
+func createMacroAdhocFilters(filters []adhocFilter) sqlutil.MacroFunc {
+	return func(query *sqlutil.Query, args []string) (string, error) {
+		return adhocFilterClause(filters)
+	}
+}
+
+// wrapWithAdhocFilters wraps a statement in a subquery filtered by the ad-hoc
+// filters. Statements other than SELECT and WITH queries, such as SHOW or
+// EXPLAIN, cannot be subqueries and are returned unchanged.
+func wrapWithAdhocFilters(sql string, filters []adhocFilter) (string, error) {
+	clause, err := adhocFilterClause(filters)
+	if err != nil {
+		return "", err
+	}
+	if keywords := sqlKeywords(sql); len(keywords) == 0 || keywords[0] != "SELECT" && keywords[0] != "WITH" {
+		return sql, nil
+	}
+	sql = strings.TrimRight(strings.TrimSpace(sql), ";")
+	// The closing parenthesis goes on its own line so that a trailing line
+	// comment does not comment it out.
+	return fmt.Sprintf("SELECT * FROM (%s\n) AS adhoc_filtered WHERE %s", sql, clause), nil
+}
+
+// quoteIdentifier quotes a SQL identifier, escaping embedded double quotes.
+func quoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// quoteTableName quotes each part of a possibly qualified table name.
+func quoteTableName(name string) string {
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		parts[i] = quoteIdentifier(part)
+	}
+	return strings.Join(parts, ".")
+}
+
+// quoteLiteral quotes a SQL string literal, escaping embedded single quotes.
+func quoteLiteral(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
@@ -0,0 +1,42 @@
+package arrow_flightsql
+
+import "testing"
+
+func TestWrapWithAdhocFilters(t *testing.T) {
+	filters := []adhocFilter{{Key: "host", Operator: "=", Value: "a"}}
+	tests := []struct {
+		name string
+		sql  string
+		want string
+	}{
+		{
+			name: "select",
+			sql:  "SELECT * FROM t;",
+			want: "SELECT * FROM (SELECT * FROM t\n) AS adhoc_filtered WHERE \"host\" = 'a'",
+		},
+		{
+			name: "trailing line comment",
+			sql:  "SELECT * FROM t -- all rows",
+			want: "SELECT * FROM (SELECT * FROM t -- all rows\n) AS adhoc_filtered WHERE \"host\" = 'a'",
+		},
+		{
+			name: "with",
+			sql:  "WITH x AS (SELECT 1) SELECT * FROM x",
+			want: "SELECT * FROM (WITH x AS (SELECT 1) SELECT * FROM x\n) AS adhoc_filtered WHERE \"host\" = 'a'",
+		},
+		{name: "show", sql: "SHOW TABLES", want: "SHOW TABLES"},
+		{name: "describe", sql: "DESCRIBE t", want: "DESCRIBE t"},
+		{name: "explain", sql: "EXPLAIN SELECT * FROM t", want: "EXPLAIN SELECT * FROM t"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := wrapWithAdhocFilters(tt.sql, filters)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
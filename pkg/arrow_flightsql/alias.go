@@ -0,0 +1,57 @@
+package arrow_flightsql
+
+import (
+	"regexp"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// aliasPattern matches the {{name}} placeholders of a series naming template.
+var aliasPattern = regexp.MustCompile(`\{\{\s*([^{}\s]+)\s*\}\}`)
+
+// applyAlias sets the display name of the value fields of wide and multi time
+// series frames from a naming template. {{__field_name}} is replaced by the
+// name of the field and any other {{name}} by the value of the label name,
+// or nothing if the field has no such label. The fields and their configs are
+// copied first, as they may be shared with a cached frame.
+func applyAlias(frames data.Frames, alias string) {
+	if alias == "" {
+		return
+	}
+	for _, frame := range frames {
+		if frame.Meta == nil {
+			continue
+		}
+		switch frame.Meta.Type {
+		case data.FrameTypeTimeSeriesWide, data.FrameTypeTimeSeriesMulti:
+		default:
+			continue
+		}
+		fields := make([]*data.Field, len(frame.Fields))
+		for i, field := range frame.Fields {
+			fields[i] = field
+			if field.Type().Time() {
+				continue
+			}
+			aliased := *field
+			aliased.Config = &data.FieldConfig{}
+			if field.Config != nil {
+				*aliased.Config = *field.Config
+			}
+			aliased.Config.DisplayNameFromDS = expandAlias(alias, field)
+			fields[i] = &aliased
+		}
+		frame.Fields = fields
+	}
+}
+
+// expandAlias evaluates a naming template for a field.
+func expandAlias(alias string, field *data.Field) string {
+	return aliasPattern.ReplaceAllStringFunc(alias, func(m string) string {
+		name := aliasPattern.FindStringSubmatch(m)[1]
+		if name == "__field_name" {
+			return field.Name
+		}
+		return field.Labels[name]
+	})
+}
@@ -0,0 +1,26 @@
+package arrow_flightsql
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+func TestApplyAlias(t *testing.T) {
+	value := data.NewField("cpu", data.Labels{"host": "a"}, []float64{1})
+	value.Config = &data.FieldConfig{Unit: "percent"}
+	cached := data.NewFrame("", data.NewField("time", nil, []time.Time{{}}), value)
+
+	frame := shallowFrame(cached)
+	setFrameType(frame, data.FrameTypeTimeSeriesWide)
+	applyAlias(data.Frames{frame}, "{{host}} {{__field_name}}")
+
+	got := frame.Fields[1].Config
+	if got.DisplayNameFromDS != "a cpu" || got.Unit != "percent" {
+		t.Errorf("got display name %q and unit %q", got.DisplayNameFromDS, got.Unit)
+	}
+	if cached.Fields[1] != value || value.Config.DisplayNameFromDS != "" {
+		t.Error("the cached frame was modified")
+	}
+}
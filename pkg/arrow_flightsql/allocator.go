@@ -0,0 +1,119 @@
+package arrow_flightsql
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/memory"
+)
+
+// checkedAllocatorEnv enables leak checking of the Arrow memory of every
+// statement when set to "true". It is meant for tests and development.
+const checkedAllocatorEnv = "GF_PLUGIN_DATALAYERS_CHECKED_ALLOCATOR"
+
+var errMemoryLimit = errors.New("memory limit exceeded")
+
+// trackingAllocator counts the Arrow memory currently allocated by the
+// queries of an instance, and the memory of the frames being converted from it.
+type trackingAllocator struct {
+	mem memory.Allocator
+	// limit is the ceiling in bytes; zero means unlimited.
+	limit int64
+	used  atomic.Int64
+	// converted is the estimated size of the frames being built from records.
+	converted atomic.Int64
+}
+
+func newTrackingAllocator(limit int64) *trackingAllocator {
+	return &trackingAllocator{mem: memory.NewGoAllocator(), limit: limit}
+}
+
+func (a *trackingAllocator) Allocate(size int) []byte {
+	a.used.Add(int64(size))
+	return a.mem.Allocate(size)
+}
+
+func (a *trackingAllocator) Reallocate(size int, b []byte) []byte {
+	a.used.Add(int64(size - len(b)))
+	return a.mem.Reallocate(size, b)
+}
+
+func (a *trackingAllocator) Free(b []byte) {
+	a.used.Add(-int64(len(b)))
+	a.mem.Free(b)
+}
+
+// CurrentAlloc returns the number of bytes currently allocated.
+func (a *trackingAllocator) CurrentAlloc() int64 {
+	return a.used.Load()
+}
+
+// reserve adds n bytes of converted frames to the memory counted against the
+// ceiling.
+func (a *trackingAllocator) reserve(n int64) {
+	if a != nil {
+		a.converted.Add(n)
+	}
+}
+
+// release removes n bytes reserved for converted frames.
+func (a *trackingAllocator) release(n int64) {
+	if a != nil {
+		a.converted.Add(-n)
+	}
+}
+
+// checkLimit returns an error when the allocated Arrow memory plus the size
+// of the frames being converted exceeds the ceiling.
+func (a *trackingAllocator) checkLimit() error {
+	if a == nil || a.limit <= 0 {
+		return nil
+	}
+	if used := a.used.Load() + a.converted.Load(); used > a.limit {
+		return fmt.Errorf("%w: queries of this datasource hold %d MiB of Arrow memory, the limit is %d MiB; narrow the query or raise the limit", errMemoryLimit, used>>20, a.limit>>20)
+	}
+	return nil
+}
+
+// recordSize returns the size of the buffers of a record, which estimates the
+// size of the frame rows it is converted into.
+func recordSize(record arrow.Record) int64 {
+	var n int64
+	for _, col := range record.Columns() {
+		n += arrayDataSize(col.Data())
+	}
+	return n
+}
+
+func arrayDataSize(d arrow.ArrayData) int64 {
+	var n int64
+	for _, b := range d.Buffers() {
+		if b != nil {
+			n += int64(b.Len())
+		}
+	}
+	for _, child := range d.Children() {
+		n += arrayDataSize(child)
+	}
+	return n
+}
+
+// statementAllocator returns the allocator for the records of a single
+// statement and a function to call once they are all released. With
+// checkedAllocatorEnv set, the allocator is checked and the function returns
+// an error if any bytes are still outstanding.
+func (d *DataSource) statementAllocator() (memory.Allocator, func() error) {
+	if os.Getenv(checkedAllocatorEnv) != "true" {
+		return d.alloc, func() error { return nil }
+	}
+	checked := memory.NewCheckedAllocator(d.alloc)
+	return checked, func() error {
+		if n := checked.CurrentAlloc(); n != 0 {
+			return fmt.Errorf("arrow memory leak: %d bytes still allocated after the statement", n)
+		}
+		return nil
+	}
+}
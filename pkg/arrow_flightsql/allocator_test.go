@@ -0,0 +1,74 @@
+package arrow_flightsql
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// callResource calls a resource of the datasource and returns its response.
+func callResource(t *testing.T, ds *DataSource, path string) *backend.CallResourceResponse {
+	t.Helper()
+	var resp *backend.CallResourceResponse
+	err := ds.CallResource(context.Background(), &backend.CallResourceRequest{Method: http.MethodGet, Path: path, URL: path},
+		backend.CallResourceResponseSenderFunc(func(r *backend.CallResourceResponse) error {
+			resp = r
+			return nil
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestQueryPathsReleaseArrowMemory(t *testing.T) {
+	ds, mem := newTestDataSource(t, 3, 100)
+
+	queries := map[string]map[string]any{
+		"table":       {"queryText": "SELECT * FROM demo", "rawEditor": true, "format": "table"},
+		"timeSeries":  {"queryText": "SELECT * FROM demo", "rawEditor": true, "format": "time_series"},
+		"statements":  {"queryText": "SELECT 1; SELECT 2", "rawEditor": true, "format": "table", "splitStatements": true},
+		"split":       {"queryText": "SELECT * FROM demo WHERE $__timeFilter(time)", "rawEditor": true, "format": "table", "splitDuration": "10m"},
+		"builder":     {"table": "demo", "dbSchema": "public", "columns": []string{"time", "value"}, "format": "table"},
+		"incremental": {"queryText": "SELECT * FROM demo WHERE $__timeFilter(time)", "rawEditor": true, "format": "time_series", "incrementalCache": true},
+	}
+	for name, q := range queries {
+		t.Run(name, func(t *testing.T) {
+			resp, err := ds.QueryData(context.Background(), &backend.QueryDataRequest{
+				Queries: []backend.DataQuery{testQuery(t, "A", q)},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := resp.Responses["A"]
+			if r.Error != nil {
+				t.Fatal(r.Error)
+			}
+			if len(r.Frames) == 0 || r.Frames[0].Rows() == 0 {
+				t.Fatal("got no rows")
+			}
+			mem.AssertSize(t, 0)
+		})
+	}
+}
+
+func TestMetadataPathsReleaseArrowMemory(t *testing.T) {
+	ds, mem := newTestDataSource(t, 1, 10)
+
+	for _, path := range []string{
+		"flightsql/sql-info",
+		"flightsql/tables",
+		"flightsql/columns?table=demo",
+		"flightsql/tag-keys?table=demo",
+		"flightsql/tag-values?table=demo&key=host",
+	} {
+		t.Run(path, func(t *testing.T) {
+			if resp := callResource(t, ds, path); resp.Status != http.StatusOK {
+				t.Fatalf("got status %d: %s", resp.Status, resp.Body)
+			}
+			mem.AssertSize(t, 0)
+		})
+	}
+}
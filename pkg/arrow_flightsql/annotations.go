@@ -0,0 +1,149 @@
+package arrow_flightsql
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// queryTypeAnnotations identifies queries issued by Grafana's annotation editor.
+const queryTypeAnnotations = "annotations"
+
+// annotationMapping maps the fields of an annotation event to the columns of a query result.
+type annotationMapping struct {
+	Time    string `json:"time"`
+	TimeEnd string `json:"timeEnd"`
+	Text    string `json:"text"`
+	Title   string `json:"title"`
+	Tags    string `json:"tags"`
+}
+
+// withDefaults fills every unmapped annotation field with the column of the same name.
+func (m annotationMapping) withDefaults() annotationMapping {
+	if m.Time == "" {
+		m.Time = "time"
+	}
+	if m.TimeEnd == "" {
+		m.TimeEnd = "timeEnd"
+	}
+	if m.Text == "" {
+		m.Text = "text"
+	}
+	if m.Title == "" {
+		m.Title = "title"
+	}
+	if m.Tags == "" {
+		m.Tags = "tags"
+	}
+	return m
+}
+
+// formatAnnotationData converts a query result into a frame of annotation events.
+func formatAnnotationData(resp *backend.DataResponse, frame *data.Frame, mapping annotationMapping) {
+	mapping = mapping.withDefaults()
+
+	timeField, _ := frame.FieldByName(mapping.Time)
+	if timeField == nil {
+		resp.Error = fmt.Errorf("annotation query requires a %q column", mapping.Time)
+		return
+	}
+	times, err := annotationTimeField("time", timeField)
+	if err != nil {
+		resp.Error = err
+		return
+	}
+
+	annotations := data.NewFrame("annotations", times)
+	if field, _ := frame.FieldByName(mapping.TimeEnd); field != nil {
+		timeEnd, err := annotationTimeField("timeEnd", field)
+		if err != nil {
+			resp.Error = err
+			return
+		}
+		annotations.Fields = append(annotations.Fields, timeEnd)
+	}
+	if field, _ := frame.FieldByName(mapping.Title); field != nil {
+		annotations.Fields = append(annotations.Fields, annotationTextField("title", field))
+	}
+	if field, _ := frame.FieldByName(mapping.Text); field != nil {
+		annotations.Fields = append(annotations.Fields, annotationTextField("text", field))
+	}
+	if field, _ := frame.FieldByName(mapping.Tags); field != nil {
+		tags, err := annotationTagsField(field)
+		if err != nil {
+			resp.Error = err
+			return
+		}
+		annotations.Fields = append(annotations.Fields, tags)
+	}
+
+	annotations.Meta = &data.FrameMeta{}
+	if frame.Meta != nil {
+		annotations.Meta.ExecutedQueryString = frame.Meta.ExecutedQueryString
+		annotations.Meta.Custom = frame.Meta.Custom
+	}
+	resp.Frames = data.Frames{annotations}
+}
+
+// annotationTimeField copies a timestamp column into a nullable time field.
+func annotationTimeField(name string, field *data.Field) (*data.Field, error) {
+	if field.Type().NonNullableType() != data.FieldTypeTime {
+		return nil, fmt.Errorf("annotation column %q must be a timestamp, got %s", field.Name, field.Type().ItemTypeString())
+	}
+	out := data.NewField(name, nil, make([]*time.Time, field.Len()))
+	for i := 0; i < field.Len(); i++ {
+		if v, ok := field.ConcreteAt(i); ok {
+			t := v.(time.Time)
+			out.Set(i, &t)
+		}
+	}
+	return out, nil
+}
+
+// annotationTextField copies any column into a nullable string field.
+func annotationTextField(name string, field *data.Field) *data.Field {
+	out := data.NewField(name, nil, make([]*string, field.Len()))
+	for i := 0; i < field.Len(); i++ {
+		if v, ok := field.ConcreteAt(i); ok {
+			s := fmt.Sprintf("%v", v)
+			out.Set(i, &s)
+		}
+	}
+	return out
+}
+
+// annotationTagsField converts a tags column into JSON string arrays. String
+// columns are split on commas; JSON columns must already hold arrays.
+func annotationTagsField(field *data.Field) (*data.Field, error) {
+	out := data.NewField("tags", nil, make([]json.RawMessage, field.Len()))
+	for i := 0; i < field.Len(); i++ {
+		tags := []string{}
+		v, ok := field.ConcreteAt(i)
+		switch v := v.(type) {
+		case json.RawMessage:
+			if err := json.Unmarshal(v, &tags); err != nil {
+				return nil, fmt.Errorf("annotation column %q must hold string arrays: %w", field.Name, err)
+			}
+		case string:
+			for _, tag := range strings.Split(v, ",") {
+				if tag = strings.TrimSpace(tag); tag != "" {
+					tags = append(tags, tag)
+				}
+			}
+		default:
+			if ok {
+				return nil, fmt.Errorf("annotation column %q must be a string or an array, got %s", field.Name, field.Type().ItemTypeString())
+			}
+		}
+		b, err := json.Marshal(tags)
+		if err != nil {
+			return nil, err
+		}
+		out.Set(i, json.RawMessage(b))
+	}
+	return out, nil
+}
@@ -0,0 +1,144 @@
+package arrow_flightsql
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+func TestFormatAnnotationData(t *testing.T) {
+	t1 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Hour)
+	frame := data.NewFrame("",
+		data.NewField("started", nil, []time.Time{t1, t2}),
+		data.NewField("ended", nil, []*time.Time{&t2, nil}),
+		data.NewField("version", nil, []int64{41, 42}),
+		data.NewField("title", nil, []string{"deploy", "rollback"}),
+		data.NewField("tags", nil, []string{"prod, api", ""}),
+	)
+	frame.Meta = &data.FrameMeta{ExecutedQueryString: "SELECT 1"}
+
+	var resp backend.DataResponse
+	formatAnnotationData(&resp, frame, annotationMapping{Time: "started", TimeEnd: "ended", Text: "version"})
+	if resp.Error != nil {
+		t.Fatal(resp.Error)
+	}
+	out := resp.Frames[0]
+	var names []string
+	for _, f := range out.Fields {
+		names = append(names, f.Name)
+	}
+	if got := strings.Join(names, ","); got != "time,timeEnd,title,text,tags" {
+		t.Fatalf("got fields %s", got)
+	}
+	if got := *out.Fields[0].At(1).(*time.Time); !got.Equal(t2) {
+		t.Errorf("got time %s, want %s", got, t2)
+	}
+	if got := out.Fields[1].At(1).(*time.Time); got != nil {
+		t.Errorf("got time end %s, want null", got)
+	}
+	if got := *out.Fields[3].At(0).(*string); got != "41" {
+		t.Errorf("got text %q, want 41", got)
+	}
+	if got := string(out.Fields[4].At(0).(json.RawMessage)); got != `["prod","api"]` {
+		t.Errorf("got tags %s", got)
+	}
+	if out.Meta.ExecutedQueryString != "SELECT 1" {
+		t.Errorf("got executed query %q", out.Meta.ExecutedQueryString)
+	}
+}
+
+func TestFormatAnnotationDataErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		frame   *data.Frame
+		wantErr string
+	}{
+		{
+			name:    "missing time column",
+			frame:   data.NewFrame("", data.NewField("text", nil, []string{"a"})),
+			wantErr: `requires a "time" column`,
+		},
+		{
+			name:    "time column of the wrong type",
+			frame:   data.NewFrame("", data.NewField("time", nil, []int64{1})),
+			wantErr: `"time" must be a timestamp`,
+		},
+		{
+			name: "time end column of the wrong type",
+			frame: data.NewFrame("",
+				data.NewField("time", nil, []time.Time{{}}),
+				data.NewField("timeEnd", nil, []string{"soon"}),
+			),
+			wantErr: `"timeEnd" must be a timestamp`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp backend.DataResponse
+			formatAnnotationData(&resp, tt.frame, annotationMapping{})
+			if resp.Error == nil || !strings.Contains(resp.Error.Error(), tt.wantErr) {
+				t.Errorf("got error %v, want %q", resp.Error, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAnnotationTagsField(t *testing.T) {
+	deploy := "deploy"
+	tests := []struct {
+		name    string
+		field   *data.Field
+		want    []string
+		wantErr string
+	}{
+		{
+			name:  "comma separated",
+			field: data.NewField("tags", nil, []string{"a, b,,c ", "", " "}),
+			want:  []string{`["a","b","c"]`, `[]`, `[]`},
+		},
+		{
+			name:  "nullable strings",
+			field: data.NewField("tags", nil, []*string{&deploy, nil}),
+			want:  []string{`["deploy"]`, `[]`},
+		},
+		{
+			name:  "json arrays",
+			field: data.NewField("tags", nil, []json.RawMessage{json.RawMessage(`["a","b"]`), json.RawMessage(`[]`)}),
+			want:  []string{`["a","b"]`, `[]`},
+		},
+		{
+			name:    "json objects",
+			field:   data.NewField("tags", nil, []json.RawMessage{json.RawMessage(`{"a":1}`)}),
+			wantErr: "must hold string arrays",
+		},
+		{
+			name:    "numbers",
+			field:   data.NewField("tags", nil, []int64{1}),
+			wantErr: "must be a string or an array",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := annotationTagsField(tt.field)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, want := range tt.want {
+				if tags := string(got.At(i).(json.RawMessage)); tags != want {
+					t.Errorf("row %d: got %s, want %s", i, tags, want)
+				}
+			}
+		})
+	}
+}
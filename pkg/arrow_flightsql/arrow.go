@@ -1,11 +1,13 @@
 package arrow_flightsql
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"runtime/debug"
+	"sync"
 	"time"
 
 	"github.com/apache/arrow/go/v12/arrow"
@@ -14,6 +16,7 @@ import (
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
 	"github.com/grafana/grafana-plugin-sdk-go/data"
 	"github.com/grafana/grafana-plugin-sdk-go/data/sqlutil"
+	"go.opentelemetry.io/otel/attribute"
 	"google.golang.org/grpc/metadata"
 )
 
@@ -26,15 +29,14 @@ type recordReader interface {
 	Err() error
 }
 
-// newQueryDataResponse builds a [backend.DataResponse] from a stream of
-// [arrow.Record]s. The backend.DataResponse contains a single [data.Frame].
-func newQueryDataResponse(reader recordReader, query sqlutil.Query, headers metadata.MD) backend.DataResponse {
-	var resp backend.DataResponse
-	frame, err := frameForRecords(reader)
-	if err != nil {
-		resp.Error = err
-		return resp
-	}
+// newQueryDataResponse builds a [backend.DataResponse] from a [data.Frame]
+// converted from a query result, formatted as requested by the query.
+func newQueryDataResponse(ctx context.Context, frame *data.Frame, query queryModel, headers metadata.MD, stats *queryStats) (resp backend.DataResponse) {
+	_, span := startSpan(ctx, "datasource.format")
+	defer func() {
+		span.SetAttributes(attribute.Int("frames", len(resp.Frames)))
+		endSpan(span, resp.Error)
+	}()
 
 	if frame.Rows() == 0 {
 		resp.Frames = data.Frames{}
@@ -44,32 +46,96 @@ func newQueryDataResponse(reader recordReader, query sqlutil.Query, headers meta
 	addFrameMetadata(frame, query, headers)
 	formatFrameData(&resp, frame, query)
 
+	if query.Format == sqlutil.FormatOptionTimeSeries && resp.Error == nil {
+		applyAlias(resp.Frames, query.Alias)
+		downsampleFrames(resp.Frames, query.MaxDataPoints, query.Downsample)
+	}
+
+	if query.FromAlert && resp.Error == nil {
+		resp.Error = validateAlertFrames(resp.Frames)
+	}
+
+	frameStats := stats.frameStats()
+	for _, f := range resp.Frames {
+		if f.Meta == nil {
+			f.Meta = &data.FrameMeta{}
+		}
+		f.Meta.Stats = frameStats
+	}
+
 	return resp
 }
 
-func frameForRecords(reader recordReader) (*data.Frame, error) {
+// frameForRecords converts the records of a reader into a frame. Each record
+// is copied into the frame as soon as it is read, so the reader only holds one
+// record at a time. When the server announced the number of records, the
+// fields are allocated at their final size up front instead of growing with
+// every batch. The query is aborted when the Arrow memory held by the
+// instance, plus the frames it is being converted into, exceeds the limit of
+// mem. The columns of a record are converted by up to workers goroutines.
+func frameForRecords(reader recordReader, stats *queryStats, mem *trackingAllocator, workers int) (*data.Frame, error) {
 	frame := newFrame(reader.Schema())
-	rows := int64(0)
+	if n := stats.totalRecords; n > 0 {
+		if n > rowLimit {
+			n = rowLimit
+		}
+		for _, field := range frame.Fields {
+			field.Extend(int(n))
+		}
+	}
+
+	// The converted rows count against the memory limit until the frame is
+	// returned, since each record is released as soon as it is copied.
+	var converted int64
+	defer func() { mem.release(converted) }()
 
+	rows := 0
 	for reader.Next() {
-		if err := appendRecordToFrame(frame, reader.Record()); err != nil {
+		// The batch is recorded before it is converted so that the time to the
+		// first batch only covers the server.
+		stats.recordBatch(reader.Record().NumRows())
+		size := recordSize(reader.Record())
+		mem.reserve(size)
+		converted += size
+		if err := appendRecordToFrame(frame, rows, reader.Record(), workers); err != nil {
 			return nil, err
 		}
-
-		rows += reader.Record().NumRows()
-		if rows > rowLimit {
-			addRowLimitNotice(frame)
-			return frame, nil
+		if err := mem.checkLimit(); err != nil {
+			return nil, err
 		}
+		rows += int(reader.Record().NumRows())
 
-		if err := reader.Err(); err != nil && !errors.Is(err, io.EOF) {
-			return nil, err
+		if stats.rows > rowLimit {
+			stats.rowLimitReached = true
+			addRowLimitNotice(frame)
+			break
 		}
 	}
+	// Next also returns false when the stream fails; the frame must not be
+	// returned truncated then.
+	if err := reader.Err(); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
 
+	if frame.Rows() > rows {
+		truncateFrame(frame, rows)
+	}
 	return frame, nil
 }
 
+// truncateFrame drops the rows of a frame from row n on. It is only needed
+// when the server announced more records than it sent.
+func truncateFrame(frame *data.Frame, n int) {
+	for i, field := range frame.Fields {
+		out := data.NewFieldFromFieldType(field.Type(), n)
+		out.Name, out.Labels, out.Config = field.Name, field.Labels, field.Config
+		for row := 0; row < n; row++ {
+			out.Set(row, field.At(row))
+		}
+		frame.Fields[i] = out
+	}
+}
+
 func newFrame(schema *arrow.Schema) *data.Frame {
 	fields := schema.Fields()
 	df := &data.Frame{
@@ -126,45 +192,55 @@ func newDataField[T any](f arrow.Field) *data.Field {
 	return data.NewField(f.Name, nil, s)
 }
 
-func cloneData(field *data.Field, col arrow.Array) (err error) {
+// cloneData copies the values of an Arrow array into a field starting at row
+// offset. The field must already hold at least offset+col.Len() rows.
+func cloneData(field *data.Field, offset int, col arrow.Array) (err error) {
+	// A panic on an unexpected array layout fails the query instead of the
+	// plugin; it may happen on a conversion worker, where it cannot be recovered
+	// by the caller.
 	defer func() {
-		recoverFromPanic()
+		if r := recover(); r != nil {
+			logErrorf("Panic: %s %s", r, string(debug.Stack()))
+			err = fmt.Errorf("panic converting column %s -> %v", field.Name, r)
+		}
 	}()
 
-	data := col.Data()
-
 	switch col.DataType().ID() {
 	case arrow.TIMESTAMP:
 		unit := getTimeUnit(col)
-		copyTimestampData(field, array.NewTimestampData(data), unit)
+		copyTimestampData(field, offset, col.(*array.Timestamp), unit)
 	case arrow.DENSE_UNION:
-		err = copyDenseUnion(field, array.NewDenseUnionData(data))
+		err = copyDenseUnion(field, offset, col.(*array.DenseUnion))
 	case arrow.STRING:
-		copyBasic[string](field, array.NewStringData(data))
+		copyBasic[string](field, offset, col.(*array.String))
 	case arrow.UINT8:
-		copyBasic[uint8](field, array.NewUint8Data(data))
+		copyBasic[uint8](field, offset, col.(*array.Uint8))
 	case arrow.UINT16:
-		copyBasic[uint16](field, array.NewUint16Data(data))
+		copyBasic[uint16](field, offset, col.(*array.Uint16))
 	case arrow.UINT32:
-		copyBasic[uint32](field, array.NewUint32Data(data))
+		copyBasic[uint32](field, offset, col.(*array.Uint32))
 	case arrow.UINT64:
-		copyBasic[uint64](field, array.NewUint64Data(data))
+		copyBasic[uint64](field, offset, col.(*array.Uint64))
 	case arrow.INT8:
-		copyBasic[int8](field, array.NewInt8Data(data))
+		copyBasic[int8](field, offset, col.(*array.Int8))
 	case arrow.INT16:
-		copyBasic[int16](field, array.NewInt16Data(data))
+		copyBasic[int16](field, offset, col.(*array.Int16))
 	case arrow.INT32:
-		copyBasic[int32](field, array.NewInt32Data(data))
+		copyBasic[int32](field, offset, col.(*array.Int32))
 	case arrow.INT64:
-		copyBasic[int64](field, array.NewInt64Data(data))
+		copyBasic[int64](field, offset, col.(*array.Int64))
 	case arrow.FLOAT32:
-		copyBasic[float32](field, array.NewFloat32Data(data))
+		copyBasic[float32](field, offset, col.(*array.Float32))
 	case arrow.FLOAT64:
-		copyBasic[float64](field, array.NewFloat64Data(data))
+		copyBasic[float64](field, offset, col.(*array.Float64))
 	case arrow.BOOL:
-		copyBasic[bool](field, array.NewBooleanData(data))
+		copyBasic[bool](field, offset, col.(*array.Boolean))
 	case arrow.DURATION:
-		copyBasic[int64](field, array.NewInt64Data(data))
+		// Durations are exposed as their integer value. The array viewing
+		// them as integers holds a reference to the data and must be released.
+		durations := array.NewInt64Data(col.Data())
+		defer durations.Release()
+		copyBasic[int64](field, offset, durations)
 	}
 
 	return err
@@ -185,39 +261,44 @@ type arrowArray[T any] interface {
 	Len() int
 }
 
-func copyBasic[T any, Array arrowArray[T]](dst *data.Field, src Array) {
-	for i := 0; i < src.Len(); i++ {
-		if dst.Nullable() {
-			if src.IsNull(i) {
-				var s *T
-				dst.Append(s)
-				continue
-			}
-			s := src.Value(i)
-			dst.Append(&s)
+// copyBasic copies the values of src into dst starting at row offset. Null
+// rows are left as they are. The values of a nullable field point into a
+// single slice allocated per batch rather than into one allocation per value.
+func copyBasic[T any, Array arrowArray[T]](dst *data.Field, offset int, src Array) {
+	if !dst.Nullable() {
+		for i := 0; i < src.Len(); i++ {
+			dst.Set(offset+i, src.Value(i))
+		}
+		return
+	}
+	values := make([]T, src.Len())
+	for i := range values {
+		if src.IsNull(i) {
 			continue
 		}
-		dst.Append(src.Value(i))
+		values[i] = src.Value(i)
+		dst.Set(offset+i, &values[i])
 	}
 }
 
-func copyTimestampData(dst *data.Field, src *array.Timestamp, unit arrow.TimeUnit) {
-	for i := 0; i < src.Len(); i++ {
-		if dst.Nullable() {
-			if src.IsNull(i) {
-				var t *time.Time
-				dst.Append(t)
-				continue
-			}
-			t := src.Value(i).ToTime(unit)
-			dst.Append(&t)
+func copyTimestampData(dst *data.Field, offset int, src *array.Timestamp, unit arrow.TimeUnit) {
+	if !dst.Nullable() {
+		for i := 0; i < src.Len(); i++ {
+			dst.Set(offset+i, src.Value(i).ToTime(unit))
+		}
+		return
+	}
+	values := make([]time.Time, src.Len())
+	for i := range values {
+		if src.IsNull(i) {
 			continue
 		}
-		dst.Append(src.Value(i).ToTime(unit))
+		values[i] = src.Value(i).ToTime(unit)
+		dst.Set(offset+i, &values[i])
 	}
 }
 
-func copyDenseUnion(dst *data.Field, v *array.DenseUnion) error {
+func copyDenseUnion(dst *data.Field, offset int, v *array.DenseUnion) error {
 	for i := 0; i < v.Len(); i++ {
 		sc, err := scalar.GetScalar(v, i)
 		if err != nil {
@@ -242,27 +323,65 @@ func copyDenseUnion(dst *data.Field, v *array.DenseUnion) error {
 		if err != nil {
 			return err
 		}
-		dst.Append(json.RawMessage(b))
+		raw := json.RawMessage(b)
+		if dst.Nullable() {
+			dst.Set(offset+i, &raw)
+		} else {
+			dst.Set(offset+i, raw)
+		}
 	}
 	return nil
 }
 
-func recoverFromPanic() {
-	if r := recover(); r != nil {
-		logErrorf("Panic: %s %s", r, string(debug.Stack()))
+// appendRecordToFrame copies the rows of a record into a frame starting at row
+// offset, extending the fields of the frame when they are too short. With more
+// than one worker, columns are converted concurrently; each column only writes
+// its own field, so the result is the same as converting them in order.
+func appendRecordToFrame(frame *data.Frame, offset int, record arrow.Record, workers int) error {
+	n := int(record.NumRows())
+	for _, field := range frame.Fields {
+		if grow := offset + n - field.Len(); grow > 0 {
+			field.Extend(grow)
+		}
+	}
+
+	cols := record.Columns()
+	if workers <= 1 || len(cols) < 2 {
+		for i, col := range cols {
+			if err := cloneData(frame.Fields[i], offset, col); err != nil {
+				return err
+			}
+		}
+		return nil
 	}
-}
 
-func appendRecordToFrame(frame *data.Frame, record arrow.Record) error {
-	for i, col := range record.Columns() {
-		if err := cloneData(frame.Fields[i], col); err != nil {
+	errs := make([]error, len(cols))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(workers, len(cols)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				errs[i] = cloneData(frame.Fields[i], offset, cols[i])
+			}
+		}()
+	}
+	for i := range cols {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func addFrameMetadata(frame *data.Frame, query sqlutil.Query, headers metadata.MD) {
+func addFrameMetadata(frame *data.Frame, query queryModel, headers metadata.MD) {
 	frame.Meta.Custom = map[string]any{
 		"headers": headers,
 	}
@@ -270,36 +389,218 @@ func addFrameMetadata(frame *data.Frame, query sqlutil.Query, headers metadata.M
 	frame.Meta.DataTopic = data.DataTopic(query.RawSQL)
 }
 
-func formatFrameData(resp *backend.DataResponse, frame *data.Frame, query sqlutil.Query) {
+func formatFrameData(resp *backend.DataResponse, frame *data.Frame, query queryModel) {
+	if query.QueryType == queryTypeAnnotations {
+		formatAnnotationData(resp, frame, query.AnnotationMapping)
+		return
+	}
+
 	switch query.Format {
 	case sqlutil.FormatOptionTimeSeries:
-		formatTimeSeriesData(resp, frame)
+		formatTimeSeriesData(resp, frame, query.TimeSeriesOutput)
 	case sqlutil.FormatOptionTable:
+		if isNumericLong(frame) {
+			setFrameType(frame, data.FrameTypeNumericLong)
+		} else {
+			setFrameType(frame, data.FrameTypeTable)
+		}
 		resp.Frames = data.Frames{frame}
 	case sqlutil.FormatOptionLogs:
+		if isLogLines(frame) {
+			setFrameType(frame, data.FrameTypeLogLines)
+			frame.Meta.TypeVersion = data.FrameTypeVersion{0, 0}
+		}
 		resp.Frames = data.Frames{frame}
 	default:
 		resp.Error = fmt.Errorf("unsupported format")
 	}
 }
 
-func formatTimeSeriesData(resp *backend.DataResponse, frame *data.Frame) {
+func formatTimeSeriesData(resp *backend.DataResponse, frame *data.Frame, output timeSeriesOutput) {
 	if _, idx := frame.FieldByName("time"); idx == -1 {
 		resp.Error = fmt.Errorf("no time column found")
 		return
 	}
 
-	if frame.TimeSeriesSchema().Type == data.TimeSeriesTypeLong {
+	switch frame.TimeSeriesSchema().Type {
+	case data.TimeSeriesTypeLong:
+		switch output {
+		case timeSeriesOutputMulti:
+			resp.Frames = longToMulti(frame)
+			return
+		case timeSeriesOutputLong:
+			setFrameType(frame, data.FrameTypeTimeSeriesLong)
+			resp.Frames = data.Frames{frame}
+			return
+		}
 		var err error
 		frame, err = data.LongToWide(frame, nil)
 		if err != nil {
 			resp.Error = err
 			return
 		}
+		setFrameType(frame, data.FrameTypeTimeSeriesWide)
+	case data.TimeSeriesTypeWide:
+		if output == timeSeriesOutputMulti {
+			resp.Frames = wideToMulti(frame)
+			return
+		}
+		setFrameType(frame, data.FrameTypeTimeSeriesWide)
 	}
 	resp.Frames = data.Frames{frame}
 }
 
+// longToMulti splits a long time series frame into one frame per series. Each
+// unique combination of factor values and value field becomes its own frame
+// holding the time field and a single value field labelled with those factors.
+// Frames are returned in the order their series first appear, with their rows
+// sorted by time.
+func longToMulti(longFrame *data.Frame) data.Frames {
+	longFrame = sortFrameByTime(longFrame)
+	tsSchema := longFrame.TimeSeriesSchema()
+	timeField := longFrame.Fields[tsSchema.TimeIndex]
+
+	var frames data.Frames
+	seriesIdx := make(map[string]int)
+	for row := 0; row < timeField.Len(); row++ {
+		labels := make(data.Labels, len(tsSchema.FactorIndices))
+		for _, i := range tsSchema.FactorIndices {
+			labels[longFrame.Fields[i].Name] = labelValueAt(longFrame.Fields[i], row)
+		}
+		labelsKey := labels.String()
+
+		for _, i := range tsSchema.ValueIndices {
+			valueField := longFrame.Fields[i]
+			key := valueField.Name + labelsKey
+			idx, ok := seriesIdx[key]
+			if !ok {
+				idx = len(frames)
+				seriesIdx[key] = idx
+				frames = append(frames, newSeriesFrame(longFrame, timeField, valueField, labels))
+			}
+			frames[idx].Fields[0].Append(timeField.At(row))
+			frames[idx].Fields[1].Append(valueField.At(row))
+		}
+	}
+	return frames
+}
+
+// wideToMulti splits a wide time series frame into one frame per value field,
+// each holding the time field and the value field with its labels.
+func wideToMulti(wideFrame *data.Frame) data.Frames {
+	wideFrame = sortFrameByTime(wideFrame)
+	tsSchema := wideFrame.TimeSeriesSchema()
+	timeField := wideFrame.Fields[tsSchema.TimeIndex]
+
+	frames := make(data.Frames, 0, len(tsSchema.ValueIndices))
+	for _, i := range tsSchema.ValueIndices {
+		valueField := wideFrame.Fields[i]
+		frame := newSeriesFrame(wideFrame, timeField, valueField, valueField.Labels)
+		for row := 0; row < timeField.Len(); row++ {
+			frame.Fields[0].Append(timeField.At(row))
+			frame.Fields[1].Append(valueField.At(row))
+		}
+		frames = append(frames, frame)
+	}
+	return frames
+}
+
+// newSeriesFrame creates an empty frame for a single series of a multi-frame
+// time series response. The frame shares a copy of the long frame's metadata.
+func newSeriesFrame(longFrame *data.Frame, timeField, valueField *data.Field, labels data.Labels) *data.Frame {
+	value := data.NewFieldFromFieldType(valueField.Type(), 0)
+	value.Name = valueField.Name
+	value.Labels = labels.Copy()
+	value.Config = valueField.Config
+
+	t := data.NewFieldFromFieldType(timeField.Type(), 0)
+	t.Name = timeField.Name
+
+	frame := data.NewFrame(longFrame.Name, t, value)
+	if longFrame.Meta != nil {
+		meta := *longFrame.Meta
+		frame.Meta = &meta
+	}
+	setFrameType(frame, data.FrameTypeTimeSeriesMulti)
+	return frame
+}
+
+// labelValueAt returns the string representation of a factor field's value at
+// row i. Null values are represented by the empty string.
+func labelValueAt(field *data.Field, i int) string {
+	v, ok := field.ConcreteAt(i)
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// isLogLines reports whether a frame satisfies the dataplane log-lines
+// contract: a "timestamp" time field followed by a "body" string field. Grafana
+// only displays log-lines frames that have both, so other logs results are left
+// untagged and parsed by Grafana as before.
+func isLogLines(frame *data.Frame) bool {
+	if len(frame.Fields) < 2 {
+		return false
+	}
+	timestamp, body := frame.Fields[0], frame.Fields[1]
+	return timestamp.Name == "timestamp" && timestamp.Type().Time() &&
+		body.Name == "body" && body.Type().NonNullableType() == data.FieldTypeString
+}
+
+// isNumericLong reports whether a table frame satisfies the dataplane
+// numeric-long contract: any number of string or bool label columns and
+// exactly one numeric column.
+func isNumericLong(frame *data.Frame) bool {
+	numeric := 0
+	for _, field := range frame.Fields {
+		switch {
+		case field.Type().Numeric():
+			numeric++
+		case field.Type().NonNullableType() == data.FieldTypeString, field.Type().NonNullableType() == data.FieldTypeBool:
+		default:
+			return false
+		}
+	}
+	return numeric == 1
+}
+
+// alertFrameTypes are the frame types that server-side expressions can evaluate.
+var alertFrameTypes = map[data.FrameType]struct{}{
+	data.FrameTypeTimeSeriesWide:  {},
+	data.FrameTypeTimeSeriesLong:  {},
+	data.FrameTypeTimeSeriesMulti: {},
+	data.FrameTypeNumericLong:     {},
+}
+
+// validateAlertFrames returns an error describing the first frame that
+// alerting cannot evaluate.
+func validateAlertFrames(frames data.Frames) error {
+	for _, frame := range frames {
+		var frameType data.FrameType
+		if frame.Meta != nil {
+			frameType = frame.Meta.Type
+		}
+		if _, ok := alertFrameTypes[frameType]; ok {
+			continue
+		}
+		if frameType == data.FrameTypeUnknown {
+			return fmt.Errorf("alert query returned data that is neither a time series nor a numeric table: time series need a time column and at least one numeric column")
+		}
+		return fmt.Errorf("alert query returned a %q frame: tables must contain only label columns and a single numeric column", frameType)
+	}
+	return nil
+}
+
+// setFrameType marks a frame with a Grafana dataplane frame type.
+func setFrameType(frame *data.Frame, frameType data.FrameType) {
+	if frame.Meta == nil {
+		frame.Meta = &data.FrameMeta{}
+	}
+	frame.Meta.Type = frameType
+	frame.Meta.TypeVersion = data.FrameTypeVersion{0, 1}
+}
+
 func addRowLimitNotice(frame *data.Frame) {
 	frame.AppendNotices(data.Notice{
 		Severity: data.NoticeSeverityWarning,
@@ -0,0 +1,412 @@
+package arrow_flightsql
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/array"
+	"github.com/apache/arrow/go/v12/arrow/memory"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/grafana-plugin-sdk-go/data/sqlutil"
+)
+
+// fakeReader is a recordReader over records built in memory. Err returns err
+// once all records were read.
+type fakeReader struct {
+	records []arrow.Record
+	i       int
+	err     error
+}
+
+func (r *fakeReader) Next() bool {
+	if r.i == len(r.records) {
+		return false
+	}
+	r.i++
+	return true
+}
+
+func (r *fakeReader) Schema() *arrow.Schema { return testSchema }
+func (r *fakeReader) Record() arrow.Record  { return r.records[r.i-1] }
+
+func (r *fakeReader) Err() error {
+	if r.i == len(r.records) {
+		return r.err
+	}
+	return nil
+}
+
+// testRecords builds batches records of rows rows with testSchema.
+func testRecords(batches, rows int) []arrow.Record {
+	mem := memory.NewGoAllocator()
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	records := make([]arrow.Record, batches)
+	for b := range records {
+		bldr := array.NewRecordBuilder(mem, testSchema)
+		for i := 0; i < rows; i++ {
+			n := b*rows + i
+			bldr.Field(0).(*array.TimestampBuilder).Append(arrow.Timestamp(t0.Add(time.Duration(n) * time.Millisecond).UnixNano()))
+			if n%10 == 0 {
+				bldr.Field(1).(*array.StringBuilder).AppendNull()
+			} else {
+				bldr.Field(1).(*array.StringBuilder).Append(fmt.Sprintf("host-%d", n%7))
+			}
+			bldr.Field(2).(*array.Float64Builder).Append(float64(n))
+		}
+		records[b] = bldr.NewRecord()
+		bldr.Release()
+	}
+	return records
+}
+
+func releaseRecords(records []arrow.Record) {
+	for _, r := range records {
+		r.Release()
+	}
+}
+
+func TestFrameForRecordsStreamError(t *testing.T) {
+	records := testRecords(2, 10)
+	defer releaseRecords(records)
+	errStream := errors.New("stream reset")
+
+	stats := newQueryStats()
+	stats.totalRecords = 100
+	_, err := frameForRecords(&fakeReader{records: records, err: errStream}, stats, newTrackingAllocator(0), 1)
+	if !errors.Is(err, errStream) {
+		t.Fatalf("got error %v, want %v", err, errStream)
+	}
+}
+
+func TestFrameForRecordsTruncatesToReceivedRows(t *testing.T) {
+	records := testRecords(2, 10)
+	defer releaseRecords(records)
+
+	stats := newQueryStats()
+	stats.totalRecords = 100
+	frame, err := frameForRecords(&fakeReader{records: records}, stats, newTrackingAllocator(0), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frame.Rows() != 20 {
+		t.Errorf("got %d rows, want 20", frame.Rows())
+	}
+}
+
+func TestFrameForRecordsWorkers(t *testing.T) {
+	records := testRecords(3, 100)
+	defer releaseRecords(records)
+
+	convert := func(workers int) *data.Frame {
+		stats := newQueryStats()
+		frame, err := frameForRecords(&fakeReader{records: records}, stats, newTrackingAllocator(0), workers)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return frame
+	}
+	want := convert(1)
+	for _, workers := range []int{2, 3, 8} {
+		got := convert(workers)
+		if got.Rows() != want.Rows() {
+			t.Fatalf("workers=%d: got %d rows, want %d", workers, got.Rows(), want.Rows())
+		}
+		for i, field := range want.Fields {
+			for row := 0; row < want.Rows(); row++ {
+				w, _ := field.ConcreteAt(row)
+				g, _ := got.Fields[i].ConcreteAt(row)
+				if g != w {
+					t.Fatalf("workers=%d: field %s row %d: got %v, want %v", workers, field.Name, row, g, w)
+				}
+			}
+		}
+	}
+}
+
+func TestAppendRecordToFrameRecoversPanic(t *testing.T) {
+	records := testRecords(1, 10)
+	defer releaseRecords(records)
+
+	for _, workers := range []int{1, 3} {
+		// The value column does not match the type of its field, so copying it
+		// panics.
+		frame := data.NewFrame("",
+			data.NewField("time", nil, []time.Time{}),
+			data.NewField("host", nil, []*string{}),
+			data.NewField("value", nil, []string{}),
+		)
+		err := appendRecordToFrame(frame, 0, records[0], workers)
+		if err == nil || !strings.Contains(err.Error(), "panic converting column value") {
+			t.Errorf("workers=%d: got error %v", workers, err)
+		}
+	}
+}
+
+// BenchmarkFrameForRecords converts 1M rows in 100 batches. With the total
+// announced by the server the fields are allocated once at their final size;
+// compare the B/op of both cases for the memory saved by pre-sizing.
+func BenchmarkFrameForRecords(b *testing.B) {
+	const batches, rows = 100, 10_000
+	records := testRecords(batches, rows)
+	defer releaseRecords(records)
+
+	for _, announced := range []bool{true, false} {
+		b.Run(fmt.Sprintf("announced=%v", announced), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				stats := newQueryStats()
+				if announced {
+					stats.totalRecords = batches * rows
+				}
+				frame, err := frameForRecords(&fakeReader{records: records}, stats, newTrackingAllocator(0), 1)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if frame.Rows() != batches*rows {
+					b.Fatalf("got %d rows", frame.Rows())
+				}
+			}
+		})
+	}
+}
+
+func TestLongToMulti(t *testing.T) {
+	t1 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Minute)
+	frame := data.NewFrame("",
+		data.NewField("time", nil, []time.Time{t2, t1, t1, t2}),
+		data.NewField("host", nil, []string{"a", "a", "b", "b"}),
+		data.NewField("value", nil, []float64{2, 1, 3, 4}),
+	)
+
+	frames := longToMulti(frame)
+	if len(frames) != 2 {
+		t.Fatalf("got %d frames, want 2", len(frames))
+	}
+	want := map[string][]float64{"a": {1, 2}, "b": {3, 4}}
+	for _, f := range frames {
+		if f.Meta.Type != data.FrameTypeTimeSeriesMulti {
+			t.Errorf("got frame type %q", f.Meta.Type)
+		}
+		host := f.Fields[1].Labels["host"]
+		for row, v := range want[host] {
+			if got := f.Fields[0].At(row).(time.Time); !got.Equal([]time.Time{t1, t2}[row]) {
+				t.Errorf("host %s row %d: got time %s", host, row, got)
+			}
+			if got := f.Fields[1].At(row).(float64); got != v {
+				t.Errorf("host %s row %d: got %v, want %v", host, row, got, v)
+			}
+		}
+	}
+}
+
+func TestFormatTimeSeriesMultiFromWide(t *testing.T) {
+	t1 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Minute)
+	frame := data.NewFrame("",
+		data.NewField("time", nil, []time.Time{t2, t1}),
+		data.NewField("cpu", data.Labels{"host": "a"}, []float64{2, 1}),
+		data.NewField("mem", nil, []float64{20, 10}),
+	)
+
+	var resp backend.DataResponse
+	formatTimeSeriesData(&resp, frame, timeSeriesOutputMulti)
+	if resp.Error != nil {
+		t.Fatal(resp.Error)
+	}
+	if len(resp.Frames) != 2 {
+		t.Fatalf("got %d frames, want 2", len(resp.Frames))
+	}
+	for i, want := range []struct {
+		name   string
+		labels data.Labels
+		values []float64
+	}{{"cpu", data.Labels{"host": "a"}, []float64{1, 2}}, {"mem", data.Labels{}, []float64{10, 20}}} {
+		f := resp.Frames[i]
+		if f.Meta.Type != data.FrameTypeTimeSeriesMulti || len(f.Fields) != 2 {
+			t.Fatalf("frame %d: got type %q with %d fields", i, f.Meta.Type, len(f.Fields))
+		}
+		value := f.Fields[1]
+		if value.Name != want.name || value.Labels.String() != want.labels.String() {
+			t.Errorf("frame %d: got field %s %s", i, value.Name, value.Labels)
+		}
+		for row, v := range want.values {
+			if got := value.At(row).(float64); got != v {
+				t.Errorf("frame %d row %d: got %v, want %v", i, row, got, v)
+			}
+		}
+	}
+}
+
+func TestFormatLogsFrameType(t *testing.T) {
+	t1 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		frame *data.Frame
+		want  data.FrameType
+	}{
+		{
+			name: "log lines",
+			frame: data.NewFrame("",
+				data.NewField("timestamp", nil, []time.Time{t1}),
+				data.NewField("body", nil, []string{"started"}),
+				data.NewField("level", nil, []string{"info"}),
+			),
+			want: data.FrameTypeLogLines,
+		},
+		{
+			name: "other columns",
+			frame: data.NewFrame("",
+				data.NewField("time", nil, []time.Time{t1}),
+				data.NewField("message", nil, []string{"started"}),
+			),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp backend.DataResponse
+			formatFrameData(&resp, tt.frame, queryModel{Query: sqlutil.Query{Format: sqlutil.FormatOptionLogs}})
+			var got data.FrameType
+			if meta := resp.Frames[0].Meta; meta != nil {
+				got = meta.Type
+			}
+			if got != tt.want {
+				t.Errorf("got frame type %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAlertFrameShapes(t *testing.T) {
+	t1 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		frame       *data.Frame
+		numericLong bool
+		wantErr     string
+	}{
+		{
+			name: "labels and one number",
+			frame: data.NewFrame("",
+				data.NewField("host", nil, []string{"a", "b"}),
+				data.NewField("up", nil, []*bool{nil, nil}),
+				data.NewField("value", nil, []float64{1, 2}),
+			),
+			numericLong: true,
+		},
+		{
+			name:        "one number",
+			frame:       data.NewFrame("", data.NewField("count", nil, []int64{3})),
+			numericLong: true,
+		},
+		{
+			name: "two numbers",
+			frame: data.NewFrame("",
+				data.NewField("host", nil, []string{"a"}),
+				data.NewField("cpu", nil, []float64{1}),
+				data.NewField("mem", nil, []float64{2}),
+			),
+			wantErr: `returned a "table" frame`,
+		},
+		{
+			name: "labels only",
+			frame: data.NewFrame("",
+				data.NewField("host", nil, []string{"a"}),
+			),
+			wantErr: `returned a "table" frame`,
+		},
+		{
+			name: "time column",
+			frame: data.NewFrame("",
+				data.NewField("time", nil, []time.Time{t1}),
+				data.NewField("host", nil, []string{"a"}),
+				data.NewField("value", nil, []float64{1}),
+			),
+			wantErr: `returned a "table" frame`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isNumericLong(tt.frame); got != tt.numericLong {
+				t.Errorf("isNumericLong: got %v, want %v", got, tt.numericLong)
+			}
+
+			var resp backend.DataResponse
+			formatFrameData(&resp, tt.frame, queryModel{Query: sqlutil.Query{Format: sqlutil.FormatOptionTable}, FromAlert: true})
+			err := validateAlertFrames(resp.Frames)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validateAlertFrames: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validateAlertFrames: got error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateAlertFrames(t *testing.T) {
+	typed := func(frameType data.FrameType) *data.Frame {
+		frame := data.NewFrame("")
+		if frameType != "" {
+			setFrameType(frame, frameType)
+		}
+		return frame
+	}
+	tests := []struct {
+		name    string
+		frames  data.Frames
+		wantErr string
+	}{
+		{name: "no frames"},
+		{name: "time series", frames: data.Frames{typed(data.FrameTypeTimeSeriesWide), typed(data.FrameTypeTimeSeriesMulti)}},
+		{name: "numeric long", frames: data.Frames{typed(data.FrameTypeNumericLong)}},
+		{name: "table", frames: data.Frames{typed(data.FrameTypeTimeSeriesLong), typed(data.FrameTypeTable)}, wantErr: `returned a "table" frame`},
+		{name: "untyped", frames: data.Frames{typed("")}, wantErr: "neither a time series nor a numeric table"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateAlertFrames(tt.frames)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFrameForRecordsMemoryLimit(t *testing.T) {
+	records := testRecords(10, 1000)
+	defer releaseRecords(records)
+	size := recordSize(records[0])
+
+	// Each record fits in the limit, the converted frame does not.
+	mem := newTrackingAllocator(3 * size)
+	_, err := frameForRecords(&fakeReader{records: records}, newQueryStats(), mem, 1)
+	if !errors.Is(err, errMemoryLimit) {
+		t.Fatalf("got error %v, want %v", err, errMemoryLimit)
+	}
+	if n := mem.converted.Load(); n != 0 {
+		t.Errorf("%d converted bytes still reserved after the query failed", n)
+	}
+
+	mem = newTrackingAllocator(int64(len(records)) * size)
+	if _, err := frameForRecords(&fakeReader{records: records}, newQueryStats(), mem, 1); err != nil {
+		t.Fatal(err)
+	}
+	if n := mem.converted.Load(); n != 0 {
+		t.Errorf("%d converted bytes still reserved after the query", n)
+	}
+}
@@ -0,0 +1,105 @@
+package arrow_flightsql
+
+import (
+	"context"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// auditLogger writes one structured entry per audited statement.
+var auditLogger = log.DefaultLogger.With("logger", "audit")
+
+// auditConfig controls the audit log of an instance.
+type auditConfig struct {
+	// sampleRate is the fraction of successful statements logged; failed
+	// statements are always logged.
+	sampleRate float64
+	// redact replaces the literals of logged statements.
+	redact bool
+}
+
+// newAuditConfig returns the audit configuration, or nil when auditing is disabled.
+func newAuditConfig(cfg config) *auditConfig {
+	if !cfg.AuditLog {
+		return nil
+	}
+	rate := 1.0
+	if cfg.AuditSampleRate > 0 {
+		rate = cfg.AuditSampleRate
+	}
+	return &auditConfig{sampleRate: rate, redact: cfg.AuditRedactLiterals}
+}
+
+// querySourceKey is the context key of the panel a statement is executed for.
+type querySourceKey struct{}
+
+// querySource identifies the dashboard panel a query request originates from.
+type querySource struct {
+	dashboardUID string
+	panelID      string
+}
+
+// withQuerySource records the dashboard panel of a query request in ctx.
+func withQuerySource(ctx context.Context, dashboardUID, panelID string) context.Context {
+	return context.WithValue(ctx, querySourceKey{}, querySource{dashboardUID: dashboardUID, panelID: panelID})
+}
+
+// auditStatement logs an executed statement with the user, org and panel it
+// was executed for.
+func (d *DataSource) auditStatement(ctx context.Context, sql string, stats *queryStats, err error) {
+	if err == nil && rand.Float64() >= d.audit.sampleRate {
+		return
+	}
+	if d.audit.redact {
+		sql = redactLiterals(sql)
+	}
+
+	args := append(d.requestLogArgs(ctx),
+		"endpoint", string(backend.EndpointFromContext(ctx)),
+		"statement", sql,
+		"duration", time.Since(stats.start).String(),
+		"rows", stats.rows,
+	)
+	if err != nil {
+		auditLogger.Info("Statement failed", append(args, "status", "error", "error", err.Error())...)
+		return
+	}
+	auditLogger.Info("Statement executed", append(args, "status", "ok")...)
+}
+
+// requestLogArgs returns the key/value pairs identifying the datasource, user,
+// org and panel a statement is executed for.
+func (d *DataSource) requestLogArgs(ctx context.Context) []any {
+	pCtx := backend.PluginConfigFromContext(ctx)
+	source, _ := ctx.Value(querySourceKey{}).(querySource)
+	user := ""
+	if pCtx.User != nil {
+		user = pCtx.User.Login
+	}
+	return []any{
+		"datasourceUid", d.uid,
+		"orgId", pCtx.OrgID,
+		"user", user,
+		"dashboardUid", source.dashboardUID,
+		"panelId", source.panelID,
+	}
+}
+
+// redactLiterals replaces the string and numeric literals of a statement with
+// a question mark. Quoted identifiers and comments are kept.
+func redactLiterals(sql string) string {
+	var b strings.Builder
+	for _, tok := range (sqlLexer{}).tokens(sql) {
+		switch tok.kind {
+		case tokenString, tokenNumber:
+			b.WriteByte('?')
+		default:
+			b.WriteString(tok.text)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,272 @@
+package arrow_flightsql
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/apache/arrow/go/v12/arrow"
+)
+
+// builderQuery is the structured query model produced by the query builder.
+type builderQuery struct {
+	Table      string        `json:"table"`
+	DBSchema   string        `json:"dbSchema"`
+	Columns    builderValues `json:"columns"`
+	Wheres     builderValues `json:"wheres"`
+	GroupBy    string        `json:"groupBy"`
+	OrderBy    string        `json:"orderBy"`
+	Limit      string        `json:"limit"`
+	TimeColumn string        `json:"timeColumn"`
+}
+
+// builderValues is a list of builder entries. The query editor stores entries
+// as {"value": ...} objects; plain strings are accepted too.
+type builderValues []string
+
+// UnmarshalJSON decodes a list of strings or {"value": ...} objects.
+func (v *builderValues) UnmarshalJSON(b []byte) error {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	values := make(builderValues, 0, len(raw))
+	for _, r := range raw {
+		var s string
+		if err := json.Unmarshal(r, &s); err == nil {
+			values = append(values, s)
+			continue
+		}
+		var obj struct {
+			Value string `json:"value"`
+		}
+		if err := json.Unmarshal(r, &obj); err != nil {
+			return err
+		}
+		values = append(values, obj.Value)
+	}
+	*v = values
+	return nil
+}
+
+// identifierRegex matches a bare or double-quoted identifier.
+var identifierRegex = regexp.MustCompile(`^(?:[A-Za-z_][A-Za-z0-9_]*|"(?:[^"]|"")+")$`)
+
+// aggregateRegex matches an aggregate of a single argument in a builder column.
+var aggregateRegex = regexp.MustCompile(`(?i)^(count|sum|avg|min|max)\s*\(\s*(.+?)\s*\)$`)
+
+// aliasRegex matches a builder column with an alias.
+var aliasRegex = regexp.MustCompile(`(?i)^(.+?)\s+as\s+([A-Za-z_][A-Za-z0-9_]*|"(?:[^"]|"")+")$`)
+
+// literalKeywords are bare words that are values rather than columns.
+var literalKeywords = map[string]struct{}{
+	"NULL":  {},
+	"TRUE":  {},
+	"FALSE": {},
+}
+
+// orderRegex matches an order by item with an optional direction.
+var orderRegex = regexp.MustCompile(`(?i)^(.+?)(?:\s+(asc|desc))?$`)
+
+// comparisonRegex matches a where entry comparing an identifier to an expression.
+var comparisonRegex = regexp.MustCompile(`(?i)^("(?:[^"]|"")+"|[A-Za-z_][A-Za-z0-9_]*)\s*(?:=|!=|<>|<=|>=|<|>|~|!~|\s(?:not\s+)?(?:like|ilike|in|between)\s|\sis\s)`)
+
+// compile builds a SELECT statement from the builder model. The entries the
+// builder can model, bare columns and simple aggregates, are checked against
+// the table schema; any other entry, such as an expression or a macro, is
+// used as typed. The time filter is left for macro interpolation.
+func (b builderQuery) compile(schema *arrow.Schema) (string, error) {
+	columns := make(map[string]arrow.Field, len(schema.Fields()))
+	for _, f := range schema.Fields() {
+		columns[f.Name] = f
+	}
+	identifier := func(name string) (string, error) {
+		name = unquoteIdentifier(name)
+		if _, ok := columns[name]; !ok {
+			return "", fmt.Errorf("column %q does not exist in table %q", name, b.Table)
+		}
+		return quoteIdentifier(name), nil
+	}
+	// aliases holds the aliases of the selected columns, which group by and
+	// order by may refer to. opaque is set when a selected column was used as
+	// typed, as it may define aliases too, such as $__dateBinAlias.
+	aliases := make(map[string]struct{})
+	opaque := false
+	// expression validates an entry if it is a column or an aggregate of a
+	// column, and returns any other entry unchanged.
+	var expression func(e string) (string, error)
+	expression = func(e string) (string, error) {
+		e = strings.TrimSpace(e)
+		switch {
+		case e == "*":
+			return e, nil
+		case identifierRegex.MatchString(e):
+			if _, ok := literalKeywords[strings.ToUpper(e)]; ok {
+				return e, nil
+			}
+			return identifier(e)
+		case aliasRegex.MatchString(e):
+			m := aliasRegex.FindStringSubmatch(e)
+			inner, err := expression(m[1])
+			if err != nil {
+				return "", err
+			}
+			return inner + " AS " + m[2], nil
+		case aggregateRegex.MatchString(e):
+			m := aggregateRegex.FindStringSubmatch(e)
+			if !identifierRegex.MatchString(m[2]) {
+				return e, nil
+			}
+			arg, err := identifier(m[2])
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%s(%s)", strings.ToLower(m[1]), arg), nil
+		default:
+			return e, nil
+		}
+	}
+
+	var selects []string
+	for _, c := range b.Columns {
+		if c = strings.TrimSpace(c); c == "" {
+			continue
+		}
+		sel, err := expression(c)
+		if err != nil {
+			return "", err
+		}
+		if m := aliasRegex.FindStringSubmatch(c); m != nil {
+			aliases[unquoteIdentifier(m[2])] = struct{}{}
+		} else if sel == c && c != "*" && !identifierRegex.MatchString(c) && !aggregateRegex.MatchString(c) {
+			opaque = true
+		}
+		selects = append(selects, sel)
+	}
+	if len(selects) == 0 {
+		selects = []string{"*"}
+	}
+	table := quoteTableName(unquoteIdentifier(b.Table))
+	if b.DBSchema != "" {
+		table = quoteIdentifier(b.DBSchema) + "." + table
+	}
+	sql := fmt.Sprintf("SELECT %s FROM %s", strings.Join(selects, ", "), table)
+
+	var conditions []string
+	if b.TimeColumn != "" {
+		ident, err := identifier(strings.TrimSpace(b.TimeColumn))
+		if err != nil {
+			return "", err
+		}
+		if columns[unquoteIdentifier(strings.TrimSpace(b.TimeColumn))].Type.ID() != arrow.TIMESTAMP {
+			return "", fmt.Errorf("time column %q must be a timestamp", b.TimeColumn)
+		}
+		conditions = append(conditions, fmt.Sprintf("$__timeFilter(%s)", ident))
+	}
+	for _, w := range b.Wheres {
+		if w = strings.TrimSpace(w); w == "" {
+			continue
+		}
+		if m := comparisonRegex.FindStringSubmatch(w); m != nil {
+			if _, err := expression(m[1]); err != nil {
+				return "", err
+			}
+		}
+		conditions = append(conditions, fmt.Sprintf("(%s)", w))
+	}
+	if len(conditions) > 0 {
+		sql += " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	// groupExpression is expression for group by and order by items, which may
+	// also name an alias of a selected column.
+	groupExpression := func(e string) (string, error) {
+		if identifierRegex.MatchString(e) {
+			if _, ok := aliases[unquoteIdentifier(e)]; ok {
+				return e, nil
+			}
+			if _, ok := columns[unquoteIdentifier(e)]; !ok && opaque {
+				return e, nil
+			}
+		}
+		return expression(e)
+	}
+
+	var groups []string
+	for _, g := range splitList(b.GroupBy) {
+		expr, err := groupExpression(g)
+		if err != nil {
+			return "", err
+		}
+		groups = append(groups, expr)
+	}
+	if len(groups) > 0 {
+		sql += " GROUP BY " + strings.Join(groups, ", ")
+	}
+
+	var orders []string
+	for _, o := range splitList(b.OrderBy) {
+		m := orderRegex.FindStringSubmatch(o)
+		expr, err := groupExpression(m[1])
+		if err != nil {
+			return "", err
+		}
+		if m[2] != "" {
+			expr += " " + strings.ToUpper(m[2])
+		}
+		orders = append(orders, expr)
+	}
+	if len(orders) > 0 {
+		sql += " ORDER BY " + strings.Join(orders, ", ")
+	}
+
+	if b.Limit != "" {
+		limit, err := strconv.ParseUint(strings.TrimSpace(b.Limit), 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("limit must be a positive integer, got %q", b.Limit)
+		}
+		sql += fmt.Sprintf(" LIMIT %d", limit)
+	}
+
+	return sql, nil
+}
+
+// splitList splits a comma separated list of expressions, ignoring commas
+// inside parentheses and quotes, and drops empty items.
+func splitList(s string) []string {
+	var items []string
+	var item strings.Builder
+	depth := 0
+	for _, tok := range (sqlLexer{}).tokens(s) {
+		switch {
+		case tok.text == "(":
+			depth++
+		case tok.text == ")":
+			depth--
+		case tok.text == "," && depth == 0:
+			items = append(items, item.String())
+			item.Reset()
+			continue
+		}
+		item.WriteString(tok.text)
+	}
+	items = append(items, item.String())
+
+	out := items[:0]
+	for _, item := range items {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// unquoteIdentifier removes the double quotes surrounding an identifier.
+func unquoteIdentifier(name string) string {
+	if len(name) >= 2 && strings.HasPrefix(name, `"`) && strings.HasSuffix(name, `"`) {
+		return strings.ReplaceAll(name[1:len(name)-1], `""`, `"`)
+	}
+	return name
+}
@@ -0,0 +1,147 @@
+package arrow_flightsql
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/apache/arrow/go/v12/arrow"
+)
+
+func TestBuilderQueryCompile(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "time", Type: arrow.FixedWidthTypes.Timestamp_ns},
+		{Name: "host", Type: arrow.BinaryTypes.String},
+		{Name: "Speed", Type: arrow.PrimitiveTypes.Float64},
+	}, nil)
+
+	tests := []struct {
+		name    string
+		query   builderQuery
+		want    string
+		wantErr string
+	}{
+		{
+			name:  "columns",
+			query: builderQuery{Table: "demo", Columns: builderValues{"time", `"Speed"`}},
+			want:  `SELECT "time", "Speed" FROM "demo"`,
+		},
+		{
+			name:  "no columns",
+			query: builderQuery{Table: "demo"},
+			want:  `SELECT * FROM "demo"`,
+		},
+		{
+			name:  "database schema",
+			query: builderQuery{Table: "demo", DBSchema: "public", Columns: builderValues{"*"}},
+			want:  `SELECT * FROM "public"."demo"`,
+		},
+		{
+			name:  "aggregates",
+			query: builderQuery{Table: "demo", Columns: builderValues{"COUNT(*)", "avg(Speed)"}},
+			want:  `SELECT COUNT(*), avg("Speed") FROM "demo"`,
+		},
+		{
+			name:  "alias",
+			query: builderQuery{Table: "demo", Columns: builderValues{"host AS h", "max(Speed) as top"}},
+			want:  `SELECT "host" AS h, max("Speed") AS top FROM "demo"`,
+		},
+		{
+			name:  "custom expressions",
+			query: builderQuery{Table: "demo", Columns: builderValues{"$__dateBin(time)", "Speed * 2", "cast(Speed as int) AS s"}},
+			want:  `SELECT $__dateBin(time), Speed * 2, cast(Speed as int) AS s FROM "demo"`,
+		},
+		{
+			name: "where",
+			query: builderQuery{
+				Table:  "demo",
+				Wheres: builderValues{"host = 'a'", "Speed > 1 or Speed < 0", "$__timeFilter(time)", ""},
+			},
+			want: `SELECT * FROM "demo" WHERE (host = 'a') AND (Speed > 1 or Speed < 0) AND ($__timeFilter(time))`,
+		},
+		{
+			name:  "time column",
+			query: builderQuery{Table: "demo", TimeColumn: "time"},
+			want:  `SELECT * FROM "demo" WHERE $__timeFilter("time")`,
+		},
+		{
+			name: "group and order by",
+			query: builderQuery{
+				Table:   "demo",
+				Columns: builderValues{"$__dateBinAlias(time)", "avg(Speed)"},
+				GroupBy: "time_binned, host",
+				OrderBy: "time_binned DESC",
+			},
+			want: `SELECT $__dateBinAlias(time), avg("Speed") FROM "demo" GROUP BY time_binned, "host" ORDER BY time_binned DESC`,
+		},
+		{
+			name:  "group by alias",
+			query: builderQuery{Table: "demo", Columns: builderValues{"host AS h", "count(*)"}, GroupBy: "h"},
+			want:  `SELECT "host" AS h, count(*) FROM "demo" GROUP BY h`,
+		},
+		{
+			name:    "unknown group by column",
+			query:   builderQuery{Table: "demo", Columns: builderValues{"host", "count(*)"}, GroupBy: "region"},
+			wantErr: `column "region" does not exist`,
+		},
+		{
+			name: "group and order by expressions",
+			query: builderQuery{
+				Table:   "demo",
+				GroupBy: "$__dateBin(time), host",
+				OrderBy: "date_bin(interval '1 minute', time, now()) asc, 1",
+				Limit:   "10",
+			},
+			want: `SELECT * FROM "demo" GROUP BY $__dateBin(time), "host" ORDER BY date_bin(interval '1 minute', time, now()) ASC, 1 LIMIT 10`,
+		},
+		{
+			name:    "unknown column",
+			query:   builderQuery{Table: "demo", Columns: builderValues{"speed"}},
+			wantErr: `column "speed" does not exist`,
+		},
+		{
+			name:    "unknown aggregate column",
+			query:   builderQuery{Table: "demo", Columns: builderValues{"sum(rpm)"}},
+			wantErr: `column "rpm" does not exist`,
+		},
+		{
+			name:    "unknown where column",
+			query:   builderQuery{Table: "demo", Wheres: builderValues{"region in ('eu')"}},
+			wantErr: `column "region" does not exist`,
+		},
+		{
+			name:    "non timestamp time column",
+			query:   builderQuery{Table: "demo", TimeColumn: "host"},
+			wantErr: "must be a timestamp",
+		},
+		{
+			name:    "invalid limit",
+			query:   builderQuery{Table: "demo", Limit: "-1"},
+			wantErr: "limit must be a positive integer",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.query.compile(schema)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitList(t *testing.T) {
+	got := splitList(" a, f(b, c) ,'x,y', , \"d,e\"")
+	want := []string{"a", "f(b, c)", "'x,y'", `"d,e"`}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
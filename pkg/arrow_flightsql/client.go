@@ -17,7 +17,7 @@ import (
 )
 
 // newFlightSQLClient creates a new FlightSQL client using the provided configuration.
-func newFlightSQLClient(cfg config) (*client, error) {
+func newFlightSQLClient(cfg config, alloc memory.Allocator) (*client, error) {
 	dialOptions, err := grpcDialOptions(cfg)
 	if err != nil {
 		return nil, fmt.Errorf("newFlightSQLClient DialOptions -> %w", err)
@@ -27,25 +27,26 @@ func newFlightSQLClient(cfg config) (*client, error) {
 	if err != nil {
 		return nil, err
 	}
+	fsqlClient.Alloc = alloc
 
 	return &client{Client: fsqlClient}, nil
 }
 
 // grpcDialOptions returns the gRPC dial options based on the configuration.
 func grpcDialOptions(cfg config) ([]grpc.DialOption, error) {
+	tracing := []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(traceUnaryInterceptor),
+		grpc.WithChainStreamInterceptor(traceStreamInterceptor),
+	}
 	if cfg.Secure {
 		pool, err := x509.SystemCertPool()
 		if err != nil {
 			return nil, fmt.Errorf("x509: %s", err)
 		}
-		return []grpc.DialOption{
-			grpc.WithTransportCredentials(credentials.NewClientTLSFromCert(pool, "")),
-		}, nil
+		return append(tracing, grpc.WithTransportCredentials(credentials.NewClientTLSFromCert(pool, ""))), nil
 	}
 
-	return []grpc.DialOption{
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
-	}, nil
+	return append(tracing, grpc.WithTransportCredentials(insecure.NewCredentials())), nil
 }
 
 // client wraps a flightsql.Client to extend its behavior and provide access to gRPC headers for streaming operations.
@@ -59,12 +60,13 @@ func (c *client) FlightClient() flight.Client {
 }
 
 // DoGetWithHeaderExtraction performs a DoGet and wraps the stream to extract headers when available.
-func (c *client) DoGetWithHeaderExtraction(ctx context.Context, in *flight.Ticket, opts ...grpc.CallOption) (*flightReader, error) {
+// Records are allocated with alloc.
+func (c *client) DoGetWithHeaderExtraction(ctx context.Context, in *flight.Ticket, alloc memory.Allocator, opts ...grpc.CallOption) (*flightReader, error) {
 	stream, err := c.FlightClient().DoGet(ctx, in, opts...)
 	if err != nil {
 		return nil, err
 	}
-	return newFlightReader(stream, c.Client.Alloc)
+	return newFlightReader(stream, alloc)
 }
 
 // flightReader wraps a flight.Reader to expose the headers captured during the first read.
@@ -91,12 +93,19 @@ func (s *flightReader) Header() (metadata.MD, error) {
 	return s.extractor.Header()
 }
 
-// headerExtractor collects the stream's headers on the first call to Recv.
+// BytesRead returns the number of Flight data bytes received so far.
+func (s *flightReader) BytesRead() int64 {
+	return s.extractor.bytes
+}
+
+// headerExtractor collects the stream's headers on the first call to Recv and
+// counts the bytes received.
 type headerExtractor struct {
 	stream flight.FlightService_DoGetClient
 	once   sync.Once
 	header metadata.MD
 	err    error
+	bytes  int64
 }
 
 // Header returns the extracted headers.
@@ -110,5 +119,8 @@ func (s *headerExtractor) Recv() (*flight.FlightData, error) {
 	s.once.Do(func() {
 		s.header, s.err = s.stream.Header()
 	})
+	if data != nil {
+		s.bytes += int64(len(data.DataHeader) + len(data.DataBody) + len(data.AppMetadata))
+	}
 	return data, err
 }
@@ -13,8 +13,29 @@ type config struct {
 	Username string              `json:"username"`
 	Password string              `json:"password"`
 	Token    string              `json:"token"`
+	// OverridableHeaders lists the metadata keys a query may override, e.g. "database".
+	OverridableHeaders []string `json:"overridableHeaders"`
+	// MaxConcurrentQueries bounds the statements executing at once per instance.
+	MaxConcurrentQueries int `json:"maxConcurrentQueries"`
+	// ConversionWorkers is the number of goroutines converting the columns of a record batch.
+	ConversionWorkers int `json:"conversionWorkers"`
+	// ReadOnly rejects statements other than SELECT, WITH, SHOW, EXPLAIN and DESCRIBE.
+	ReadOnly bool `json:"readOnly"`
+	// AuditLog logs every executed statement with the user and panel it was executed for.
+	AuditLog bool `json:"auditLog"`
+	// AuditSampleRate is the fraction of successful statements audited; zero means all of them.
+	AuditSampleRate float64 `json:"auditSampleRate"`
+	// AuditRedactLiterals replaces the literals of audited statements.
+	AuditRedactLiterals bool `json:"auditRedactLiterals"`
+	// SlowQueryThreshold is the execution time, e.g. "5s", above which a statement is reported as slow.
+	SlowQueryThreshold string `json:"slowQueryThreshold"`
+	// MemoryLimitMB caps the Arrow memory held by the queries of an instance; zero means unlimited.
+	MemoryLimitMB int64 `json:"memoryLimitMB"`
 }
 
+// defaultMaxConcurrentQueries is used when MaxConcurrentQueries is not configured.
+const defaultMaxConcurrentQueries = 10
+
 // Validate the configuration
 func (cfg config) validate() error {
 	if strings.Count(cfg.Addr, ":") == 0 {
@@ -28,5 +49,21 @@ func (cfg config) validate() error {
 		return fmt.Errorf("token or username/password are required")
 	}
 
+	if cfg.MaxConcurrentQueries < 0 {
+		return fmt.Errorf("max concurrent queries must not be negative")
+	}
+
+	if cfg.ConversionWorkers < 0 {
+		return fmt.Errorf("conversion workers must not be negative")
+	}
+
+	if cfg.AuditSampleRate < 0 || cfg.AuditSampleRate > 1 {
+		return fmt.Errorf("audit sample rate must be between 0 and 1")
+	}
+
+	if cfg.MemoryLimitMB < 0 {
+		return fmt.Errorf("memory limit must not be negative")
+	}
+
 	return nil
 }
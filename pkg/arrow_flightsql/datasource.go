@@ -8,17 +8,23 @@ import (
 	"io"
 	"net/http"
 	"sort"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/apache/arrow/go/v12/arrow"
 	"github.com/apache/arrow/go/v12/arrow/array"
 	"github.com/apache/arrow/go/v12/arrow/flight"
 	"github.com/apache/arrow/go/v12/arrow/flight/flightsql"
 	"github.com/apache/arrow/go/v12/arrow/memory"
 	"github.com/go-chi/chi/v5"
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/gtime"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/instancemgmt"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/resource/httpadapter"
 	"github.com/grafana/grafana-plugin-sdk-go/data/sqlutil"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc/metadata"
 )
 
@@ -28,13 +34,46 @@ var (
 	_ backend.CheckHealthHandler    = (*DataSource)(nil)
 	_ instancemgmt.InstanceDisposer = (*DataSource)(nil)
 	_ backend.CallResourceHandler   = (*DataSource)(nil)
+	_ backend.StreamHandler         = (*DataSource)(nil)
 )
 
+// tagValuesLimit caps the number of distinct values returned for an ad-hoc filter key.
+const tagValuesLimit = 1000
+
+var errTableNotFound = errors.New("table not found")
+
 // DataSource represents a Grafana datasource plugin for Flight SQL
 type DataSource struct {
 	client          *client
 	resourceHandler backend.CallResourceHandler
 	md              metadata.MD
+	// overridableHeaders holds the lowercased metadata keys queries may override.
+	overridableHeaders map[string]struct{}
+	// queryLimiter bounds the number of statements executing at once.
+	queryLimiter chan struct{}
+	// incrementalCache keeps the results of incrementally refreshed queries.
+	incrementalCache *incrementalCache
+	// streamPollers shares pollers between identical stream subscriptions.
+	streamPollers *streamPollers
+
+	uid string
+	// alloc allocates the Arrow memory of the instance's queries.
+	alloc *trackingAllocator
+	// readOnly rejects statements that may modify data before they are sent.
+	readOnly bool
+	// slowQueryThreshold is the execution time above which a statement is
+	// reported as slow; zero disables the report.
+	slowQueryThreshold time.Duration
+	// audit is nil unless executed statements are audited.
+	audit *auditConfig
+	// conversionWorkers is the number of goroutines converting the columns of a record batch.
+	conversionWorkers int
+
+	// cfg is kept to authenticate on first use when the server was
+	// unavailable at startup. md is only written by authenticate.
+	cfg           config
+	authMu        sync.Mutex
+	authenticated bool
 }
 
 // HTTP APIs
@@ -48,6 +87,10 @@ func (d *DataSource) getMacros(w http.ResponseWriter, r *http.Request) {
 			// propperly so omit them from advertisement.
 			continue
 		}
+		if _, ok := macros[k]; ok {
+			// Advertised below with the datasource's own macros.
+			continue
+		}
 		names = append(names, k)
 	}
 	for k := range macros {
@@ -70,12 +113,9 @@ func (d *DataSource) getSQLInfo(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
 	defer cancel()
 	ctx = metadata.NewOutgoingContext(ctx, d.md)
-	info, err := d.client.GetSqlInfo(ctx, []flightsql.SqlInfo{})
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	reader, err := d.client.DoGet(ctx, info.Endpoint[0].Ticket)
+	reader, err := d.fetchMetadata(ctx, func() (*flight.FlightInfo, error) {
+		return d.client.GetSqlInfo(ctx, []flightsql.SqlInfo{})
+	})
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -93,18 +133,15 @@ func (d *DataSource) getTables(w http.ResponseWriter, r *http.Request) {
 	defer cancel()
 	ctx = metadata.NewOutgoingContext(ctx, d.md)
 
-	info, err := d.client.GetTables(ctx, &flightsql.GetTablesOpts{
-		TableTypes: []string{"BASE TABLE", "table"},
+	reader, err := d.fetchMetadata(ctx, func() (*flight.FlightInfo, error) {
+		return d.client.GetTables(ctx, &flightsql.GetTablesOpts{
+			TableTypes: []string{"BASE TABLE", "table"},
+		})
 	})
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	reader, err := d.client.DoGet(ctx, info.Endpoint[0].Ticket)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
 	defer reader.Release()
 
 	if err := writeDataResponse(w, newDataResponse(reader)); err != nil {
@@ -122,54 +159,138 @@ func (d *DataSource) getColumns(w http.ResponseWriter, r *http.Request) {
 
 	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
 	defer cancel()
-	ctx = metadata.NewOutgoingContext(ctx, d.md)
-	info, err := d.client.GetTables(ctx, &flightsql.GetTablesOpts{
-		TableNameFilterPattern: &tableName,
-		IncludeSchema:          true,
+	schema, err := d.tableSchema(ctx, d.md, "", tableName)
+	if err != nil {
+		writeTableSchemaError(w, err)
+		return
+	}
+
+	var resp backend.DataResponse
+	resp.Frames = append(resp.Frames, newFrame(schema))
+	if err := writeDataResponse(w, resp); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (d *DataSource) getTagKeys(w http.ResponseWriter, r *http.Request) {
+	tableName := r.URL.Query().Get("table")
+	if tableName == "" {
+		http.Error(w, `query parameter "table" is required`, http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+	schema, err := d.tableSchema(ctx, d.md, "", tableName)
+	if err != nil {
+		writeTableSchemaError(w, err)
+		return
+	}
+
+	keys := make([]string, 0, len(schema.Fields()))
+	for _, f := range schema.Fields() {
+		keys = append(keys, f.Name)
+	}
+	err = json.NewEncoder(w).Encode(struct {
+		TagKeys []string `json:"tagKeys"`
+	}{
+		TagKeys: keys,
 	})
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	reader, err := d.client.DoGet(ctx, info.Endpoint[0].Ticket)
+}
+
+func (d *DataSource) getTagValues(w http.ResponseWriter, r *http.Request) {
+	tableName := r.URL.Query().Get("table")
+	key := r.URL.Query().Get("key")
+	if tableName == "" || key == "" {
+		http.Error(w, `query parameters "table" and "key" are required`, http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+	query := queryModel{
+		Query: sqlutil.Query{
+			RawSQL: fmt.Sprintf("SELECT DISTINCT %s FROM %s ORDER BY 1 LIMIT %d", quoteIdentifier(key), quoteTableName(tableName), tagValuesLimit),
+			Format: sqlutil.FormatOptionTable,
+		},
+	}
+	resp := d.query(ctx, query)
+	if resp.Error != nil {
+		http.Error(w, resp.Error.Error(), int(resp.Status))
+		return
+	}
+
+	values := []string{}
+	if len(resp.Frames) > 0 && len(resp.Frames[0].Fields) > 0 {
+		field := resp.Frames[0].Fields[0]
+		for i := 0; i < field.Len(); i++ {
+			if v, ok := field.ConcreteAt(i); ok {
+				values = append(values, fmt.Sprintf("%v", v))
+			}
+		}
+	}
+	err := json.NewEncoder(w).Encode(struct {
+		TagValues []string `json:"tagValues"`
+	}{
+		TagValues: values,
+	})
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+}
+
+// tableSchema fetches the Arrow schema of a table from the server. The
+// database schema of the table is optional.
+func (d *DataSource) tableSchema(ctx context.Context, md metadata.MD, dbSchema, tableName string) (*arrow.Schema, error) {
+	ctx = metadata.NewOutgoingContext(ctx, md)
+	opts := &flightsql.GetTablesOpts{
+		TableNameFilterPattern: &tableName,
+		IncludeSchema:          true,
+	}
+	if dbSchema != "" {
+		opts.DbSchemaFilterPattern = &dbSchema
+	}
+	reader, err := d.fetchMetadata(ctx, func() (*flight.FlightInfo, error) {
+		return d.client.GetTables(ctx, opts)
+	})
+	if err != nil {
+		return nil, err
+	}
 	defer reader.Release()
 
 	if !reader.Next() {
-		http.Error(w, "table not found", http.StatusNotFound)
-		return
+		return nil, errTableNotFound
 	}
 	rec := reader.Record()
 	rec.Retain()
 	defer rec.Release()
 	reader.Next()
 	if err := reader.Err(); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return nil, newServerError(err)
 	}
 
 	indices := rec.Schema().FieldIndices("table_schema")
 	if len(indices) == 0 {
-		http.Error(w, "table_schema field not found", http.StatusInternalServerError)
-		return
-	}
-	col := rec.Column(indices[0])
-	serializedSchema := array.NewStringData(col.Data()).Value(0)
-	schema, err := flight.DeserializeSchema([]byte(serializedSchema), memory.DefaultAllocator)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return nil, errors.New("table_schema field not found")
 	}
+	serialized := array.NewStringData(rec.Column(indices[0]).Data())
+	defer serialized.Release()
+	return flight.DeserializeSchema([]byte(serialized.Value(0)), memory.DefaultAllocator)
+}
 
-	var resp backend.DataResponse
-	resp.Frames = append(resp.Frames, newFrame(schema))
-	if err := writeDataResponse(w, resp); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+// writeTableSchemaError writes an error returned by tableSchema to an HTTP response.
+func writeTableSchemaError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errTableNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
 }
 
 func newDataResponse(reader recordReader) backend.DataResponse {
@@ -177,12 +298,9 @@ func newDataResponse(reader recordReader) backend.DataResponse {
 	frame := newFrame(reader.Schema())
 READER:
 	for reader.Next() {
-		record := reader.Record()
-		for i, col := range record.Columns() {
-			if err := cloneData(frame.Fields[i], col); err != nil {
-				resp.Error = err
-				break READER
-			}
+		if err := appendRecordToFrame(frame, frame.Rows(), reader.Record(), 1); err != nil {
+			resp.Error = err
+			break READER
 		}
 		if err := reader.Err(); err != nil && !errors.Is(err, io.EOF) {
 			resp.Error = err
@@ -219,31 +337,63 @@ func NewDatasource(ctx context.Context, settings backend.DataSourceInstanceSetti
 	}
 
 	if err := cfg.validate(); err != nil {
-		return nil, fmt.Errorf("FlightSQL Config Validation Error -> ", err)
+		return nil, fmt.Errorf("FlightSQL Config Validation Error -> %w", err)
+	}
+
+	var slowQueryThreshold time.Duration
+	if cfg.SlowQueryThreshold != "" {
+		threshold, err := gtime.ParseDuration(cfg.SlowQueryThreshold)
+		if err != nil {
+			return nil, fmt.Errorf("FlightSQL Config SlowQueryThreshold Error -> %w", err)
+		}
+		slowQueryThreshold = threshold
 	}
 
-	client, err := newFlightSQLClient(cfg)
+	alloc := newTrackingAllocator(cfg.MemoryLimitMB << 20)
+	client, err := newFlightSQLClient(cfg, alloc)
 	if err != nil {
 		return nil, fmt.Errorf("FlightSQL NewDataSource Error -> %w", err)
 	}
 
-	md := createMetadata(cfg)
-
-	if md, err = authenticateClient(ctx, client, cfg, md); err != nil {
-		return nil, err
+	maxConcurrentQueries := cfg.MaxConcurrentQueries
+	if maxConcurrentQueries == 0 {
+		maxConcurrentQueries = defaultMaxConcurrentQueries
 	}
 
 	ds := &DataSource{
-		client: client,
-		md:     md,
+		client:             client,
+		md:                 createMetadata(cfg),
+		overridableHeaders: make(map[string]struct{}, len(cfg.OverridableHeaders)),
+		queryLimiter:       make(chan struct{}, maxConcurrentQueries),
+		incrementalCache:   newIncrementalCache(),
+		streamPollers:      newStreamPollers(),
+		cfg:                cfg,
+		uid:                settings.UID,
+		alloc:              alloc,
+		conversionWorkers:  cfg.ConversionWorkers,
+		readOnly:           cfg.ReadOnly,
+		audit:              newAuditConfig(cfg),
+		slowQueryThreshold: slowQueryThreshold,
+	}
+	for _, k := range cfg.OverridableHeaders {
+		ds.overridableHeaders[strings.ToLower(k)] = struct{}{}
+	}
+	if err := ds.authenticate(ctx); err != nil {
+		if !retryable(err) {
+			return nil, err
+		}
+		logWarnf("FlightSQL server unavailable, authenticating on first use: %s", err)
 	}
 	ds.resourceHandler = route(ds)
+	instanceMemory.add(ds.uid, alloc)
 
 	return ds, nil
 }
 
 // Dispose cleans up resources before instance is reaped
 func (d *DataSource) Dispose() {
+	d.streamPollers.close()
+	instanceMemory.remove(d.uid, d.alloc)
 	if err := d.client.Close(); err != nil {
 		logErrorf(err.Error())
 	}
@@ -251,14 +401,31 @@ func (d *DataSource) Dispose() {
 
 // CallResource forwards requests to an internal HTTP mux
 func (d *DataSource) CallResource(ctx context.Context, req *backend.CallResourceRequest, sender backend.CallResourceResponseSender) error {
+	ctx, span := startSpan(ctx, "datasource.callResource", trace.WithAttributes(attribute.String("path", req.Path)))
+	defer span.End()
+
+	if err := d.authenticate(ctx); err != nil {
+		return sender.Send(&backend.CallResourceResponse{
+			Status: int(errorResponse(err, backend.StatusInternal).Status),
+			Body:   []byte(err.Error()),
+		})
+	}
 	return d.resourceHandler.CallResource(ctx, req, sender)
 }
 
 // CheckHealth handles health checks sent from Grafana
 func (d *DataSource) CheckHealth(ctx context.Context, req *backend.CheckHealthRequest) (*backend.CheckHealthResult, error) {
-	query := sqlutil.Query{
-		RawSQL: "select 1",
-		Format: sqlutil.FormatOptionTable,
+	if err := d.authenticate(ctx); err != nil {
+		return &backend.CheckHealthResult{
+			Status:  backend.HealthStatusError,
+			Message: fmt.Sprintf("ERROR: %s", err),
+		}, nil
+	}
+	query := queryModel{
+		Query: sqlutil.Query{
+			RawSQL: "select 1",
+			Format: sqlutil.FormatOptionTable,
+		},
 	}
 	resp := d.query(ctx, query)
 	if resp.Error != nil {
@@ -284,6 +451,8 @@ func route(ds *DataSource) backend.CallResourceHandler {
 		r.Get("/sql-info", ds.getSQLInfo)
 		r.Get("/tables", ds.getTables)
 		r.Get("/columns", ds.getColumns)
+		r.Get("/tag-keys", ds.getTagKeys)
+		r.Get("/tag-values", ds.getTagValues)
 	})
 	return httpadapter.New(r)
 }
@@ -304,6 +473,45 @@ func createMetadata(cfg config) metadata.MD {
 	return md
 }
 
+// queryMetadata merges per-query header overrides over the datasource metadata.
+// Only keys in the datasource's allow-list may be overridden.
+func (d *DataSource) queryMetadata(overrides map[string]string) (metadata.MD, error) {
+	if len(overrides) == 0 {
+		return d.md, nil
+	}
+	md := d.md.Copy()
+	for k, v := range overrides {
+		if _, ok := d.overridableHeaders[strings.ToLower(k)]; !ok {
+			return nil, fmt.Errorf("header %q is not allowed to be overridden by queries", k)
+		}
+		md.Set(k, v)
+	}
+	return md, nil
+}
+
+// authenticate runs the basic authentication handshake until it succeeds once,
+// retrying transient failures. Entry points call it before using d.md.
+func (d *DataSource) authenticate(ctx context.Context) error {
+	d.authMu.Lock()
+	defer d.authMu.Unlock()
+	if d.authenticated {
+		return nil
+	}
+	var md metadata.MD
+	retries, err := withRetry(ctx, func() (err error) {
+		md, err = authenticateClient(ctx, d.client, d.cfg, d.md)
+		return err
+	})
+	d.observeRetries(retries)
+	if err != nil {
+		authFailuresTotal.WithLabelValues(d.uid).Inc()
+		return newServerError(err)
+	}
+	d.md = md
+	d.authenticated = true
+	return nil
+}
+
 // authenticateClient authenticates the client using basic token
 func authenticateClient(ctx context.Context, client *client, cfg config, md metadata.MD) (metadata.MD, error) {
 	if len(cfg.Username) > 0 || len(cfg.Password) > 0 {
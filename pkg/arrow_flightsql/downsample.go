@@ -0,0 +1,263 @@
+package arrow_flightsql
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// downsampleMode selects how time series results larger than MaxDataPoints are reduced.
+type downsampleMode string
+
+const (
+	// downsampleNone returns every row.
+	downsampleNone downsampleMode = ""
+	// downsampleLTTB keeps the points chosen by the Largest-Triangle-Three-Buckets algorithm.
+	downsampleLTTB downsampleMode = "lttb"
+	// downsampleMinMax keeps the minimum and maximum point of each bucket.
+	downsampleMinMax downsampleMode = "minmax"
+)
+
+// downsampleModeFromString returns the downsample mode based on the provided string.
+func downsampleModeFromString(mode string) downsampleMode {
+	switch mode {
+	case string(downsampleLTTB):
+		return downsampleLTTB
+	case string(downsampleMinMax):
+		return downsampleMinMax
+	default:
+		return downsampleNone
+	}
+}
+
+// downsampleFrames reduces every wide or multi time series frame with more
+// than maxPoints rows, attaching a notice describing the reduction.
+func downsampleFrames(frames data.Frames, maxPoints int64, mode downsampleMode) {
+	if mode == downsampleNone || maxPoints <= 0 {
+		return
+	}
+	for i, frame := range frames {
+		if frame.Meta == nil {
+			continue
+		}
+		switch frame.Meta.Type {
+		case data.FrameTypeTimeSeriesWide, data.FrameTypeTimeSeriesMulti:
+		default:
+			continue
+		}
+		rows := frame.Rows()
+		if int64(rows) <= maxPoints {
+			continue
+		}
+		frames[i] = downsampleFrame(frame, int(maxPoints), mode)
+		frames[i].AppendNotices(data.Notice{
+			Severity: data.NoticeSeverityInfo,
+			Text:     fmt.Sprintf("Downsampled from %d to %d points using %s because of the panel's max data points", rows, frames[i].Rows(), mode),
+		})
+	}
+}
+
+// downsampleFrame selects rows of a time series frame so that at most
+// maxPoints remain. With several value fields, each field gets an equal share
+// of the budget and the union of the selected rows is kept. With more value
+// fields than points, evenly spaced rows are kept instead.
+func downsampleFrame(frame *data.Frame, maxPoints int, mode downsampleMode) *data.Frame {
+	// Both algorithms read the points of a series in time order.
+	frame = sortFrameByTime(frame)
+	tsSchema := frame.TimeSeriesSchema()
+	if len(tsSchema.ValueIndices) == 0 {
+		return frame
+	}
+	budget := maxPoints / len(tsSchema.ValueIndices)
+	if budget == 0 {
+		return selectRows(frame, spacedRows(frame.Rows(), maxPoints))
+	}
+
+	x := make([]float64, frame.Rows())
+	for i := range x {
+		if v, ok := frame.Fields[tsSchema.TimeIndex].ConcreteAt(i); ok {
+			x[i] = float64(v.(time.Time).UnixNano())
+		}
+	}
+
+	selected := make(map[int]struct{})
+	for _, vi := range tsSchema.ValueIndices {
+		points := seriesPoints(x, frame.Fields[vi])
+		var keep []int
+		switch mode {
+		case downsampleLTTB:
+			keep = lttb(points, budget)
+		case downsampleMinMax:
+			keep = minMax(points, budget)
+		}
+		for _, idx := range keep {
+			selected[idx] = struct{}{}
+		}
+	}
+
+	indices := make([]int, 0, len(selected))
+	for idx := range selected {
+		indices = append(indices, idx)
+	}
+	sort.Ints(indices)
+	return selectRows(frame, indices)
+}
+
+// point is a non-null value of a series and its row in the frame.
+type point struct {
+	row  int
+	x, y float64
+}
+
+// seriesPoints returns the non-null points of a numeric field.
+func seriesPoints(x []float64, field *data.Field) []point {
+	points := make([]point, 0, field.Len())
+	for i := 0; i < field.Len(); i++ {
+		v, err := field.NullableFloatAt(i)
+		if err != nil || v == nil || math.IsNaN(*v) {
+			continue
+		}
+		points = append(points, point{row: i, x: x[i], y: *v})
+	}
+	return points
+}
+
+// lttb returns at most threshold rows chosen by the Largest-Triangle-Three-Buckets
+// algorithm. Below three points only the first and last points are kept.
+func lttb(points []point, threshold int) []int {
+	if len(points) <= threshold {
+		return pointRows(points)
+	}
+	switch {
+	case threshold <= 0:
+		return nil
+	case threshold == 1:
+		return []int{points[0].row}
+	case threshold == 2:
+		return []int{points[0].row, points[len(points)-1].row}
+	}
+
+	rows := make([]int, 0, threshold)
+	rows = append(rows, points[0].row)
+	bucketSize := float64(len(points)-2) / float64(threshold-2)
+	a := 0
+	for i := 0; i < threshold-2; i++ {
+		start := int(float64(i)*bucketSize) + 1
+		end := int(float64(i+1)*bucketSize) + 1
+
+		// Average of the next bucket is the third vertex of the triangle.
+		nextStart, nextEnd := end, int(float64(i+2)*bucketSize)+1
+		if nextEnd > len(points) {
+			nextEnd = len(points)
+		}
+		var avgX, avgY float64
+		for _, p := range points[nextStart:nextEnd] {
+			avgX += p.x
+			avgY += p.y
+		}
+		n := float64(nextEnd - nextStart)
+		avgX, avgY = avgX/n, avgY/n
+
+		maxArea, next := -1.0, start
+		for j := start; j < end; j++ {
+			area := math.Abs((points[a].x-avgX)*(points[j].y-points[a].y) - (points[a].x-points[j].x)*(avgY-points[a].y))
+			if area > maxArea {
+				maxArea, next = area, j
+			}
+		}
+		rows = append(rows, points[next].row)
+		a = next
+	}
+	return append(rows, points[len(points)-1].row)
+}
+
+// minMax returns the rows holding the minimum and maximum value of each of
+// threshold/2 buckets. With a threshold of one, the extreme of a single bucket
+// does not fit, so the point furthest from the first one is kept.
+func minMax(points []point, threshold int) []int {
+	if len(points) <= threshold {
+		return pointRows(points)
+	}
+	switch threshold {
+	case 0:
+		return nil
+	case 1:
+		far := 0
+		for j, p := range points {
+			if math.Abs(p.y-points[0].y) > math.Abs(points[far].y-points[0].y) {
+				far = j
+			}
+		}
+		return []int{points[far].row}
+	}
+	buckets := threshold / 2
+
+	rows := make([]int, 0, buckets*2)
+	bucketSize := float64(len(points)) / float64(buckets)
+	for i := 0; i < buckets; i++ {
+		start, end := int(float64(i)*bucketSize), int(float64(i+1)*bucketSize)
+		if end > len(points) {
+			end = len(points)
+		}
+		if start >= end {
+			continue
+		}
+		lo, hi := start, start
+		for j := start + 1; j < end; j++ {
+			if points[j].y < points[lo].y {
+				lo = j
+			}
+			if points[j].y > points[hi].y {
+				hi = j
+			}
+		}
+		if lo > hi {
+			lo, hi = hi, lo
+		}
+		rows = append(rows, points[lo].row)
+		if hi != lo {
+			rows = append(rows, points[hi].row)
+		}
+	}
+	return rows
+}
+
+// spacedRows returns n evenly spaced rows out of rows, including the first and
+// the last one.
+func spacedRows(rows, n int) []int {
+	if n >= rows {
+		n = rows
+	}
+	out := make([]int, n)
+	for i := range out {
+		if n > 1 {
+			out[i] = i * (rows - 1) / (n - 1)
+		}
+	}
+	return out
+}
+
+func pointRows(points []point) []int {
+	rows := make([]int, len(points))
+	for i, p := range points {
+		rows[i] = p.row
+	}
+	return rows
+}
+
+// selectRows returns a copy of the frame holding only the given rows. The
+// frame metadata and field configs are shared with the original frame.
+func selectRows(frame *data.Frame, rows []int) *data.Frame {
+	out := frame.EmptyCopy()
+	out.Meta = frame.Meta
+	for i, field := range frame.Fields {
+		out.Fields[i].Config = field.Config
+		for _, row := range rows {
+			out.Fields[i].Append(field.At(row))
+		}
+	}
+	return out
+}
@@ -0,0 +1,129 @@
+package arrow_flightsql
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// testPoints returns n points of a sine wave with a spike at row spike.
+func testPoints(n, spike int) []point {
+	points := make([]point, n)
+	for i := range points {
+		points[i] = point{row: i, x: float64(i), y: math.Sin(float64(i) / 10)}
+	}
+	points[spike].y = 100
+	return points
+}
+
+func TestLTTB(t *testing.T) {
+	points := testPoints(1000, 500)
+	for _, threshold := range []int{1, 2, 3, 10, 100} {
+		rows := lttb(points, threshold)
+		if len(rows) != threshold {
+			t.Errorf("threshold %d: got %d rows", threshold, len(rows))
+		}
+		if rows[0] != 0 {
+			t.Errorf("threshold %d: first row %d, want 0", threshold, rows[0])
+		}
+		if threshold >= 2 && rows[len(rows)-1] != 999 {
+			t.Errorf("threshold %d: last row %d, want 999", threshold, rows[len(rows)-1])
+		}
+		if threshold >= 3 && !containsRow(rows, 500) {
+			t.Errorf("threshold %d: spike not kept", threshold)
+		}
+	}
+	if rows := lttb(points[:5], 10); len(rows) != 5 {
+		t.Errorf("got %d rows for fewer points than the threshold, want 5", len(rows))
+	}
+}
+
+func TestMinMax(t *testing.T) {
+	points := testPoints(1000, 321)
+	for _, threshold := range []int{1, 2, 3, 10, 100} {
+		rows := minMax(points, threshold)
+		if len(rows) > threshold {
+			t.Errorf("threshold %d: got %d rows", threshold, len(rows))
+		}
+		if !containsRow(rows, 321) {
+			t.Errorf("threshold %d: spike not kept", threshold)
+		}
+		for i := 1; i < len(rows); i++ {
+			if rows[i] <= rows[i-1] {
+				t.Fatalf("threshold %d: rows not in order: %v", threshold, rows)
+			}
+		}
+	}
+}
+
+func TestDownsampleFrameBound(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, mode := range []downsampleMode{downsampleLTTB, downsampleMinMax} {
+		for fields := 1; fields <= 4; fields++ {
+			for maxPoints := 1; maxPoints <= 12; maxPoints++ {
+				t.Run(fmt.Sprintf("%s/%d fields/%d points", mode, fields, maxPoints), func(t *testing.T) {
+					// The rows are in reverse time order, as a query without
+					// ORDER BY may return them.
+					const rows = 100
+					times := make([]time.Time, rows)
+					for i := range times {
+						times[i] = t0.Add(time.Duration(rows-i) * time.Second)
+					}
+					frame := data.NewFrame("", data.NewField("time", nil, times))
+					for f := 0; f < fields; f++ {
+						values := make([]float64, rows)
+						for i := range values {
+							values[i] = math.Sin(float64(i*(f+1)) / 7)
+						}
+						frame.Fields = append(frame.Fields, data.NewField(fmt.Sprintf("v%d", f), nil, values))
+					}
+
+					out := downsampleFrame(frame, maxPoints, mode)
+					if out.Rows() == 0 || out.Rows() > maxPoints {
+						t.Fatalf("got %d rows, want 1 to %d", out.Rows(), maxPoints)
+					}
+					for i := 1; i < out.Rows(); i++ {
+						if !out.Fields[0].At(i).(time.Time).After(out.Fields[0].At(i - 1).(time.Time)) {
+							t.Fatalf("row %d is not after row %d", i, i-1)
+						}
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestDownsampleFrames(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	times := make([]time.Time, 50)
+	values := make([]float64, 50)
+	for i := range times {
+		times[i] = t0.Add(time.Duration(i) * time.Second)
+		values[i] = float64(i % 7)
+	}
+	wide := data.NewFrame("", data.NewField("time", nil, times), data.NewField("v", nil, values))
+	setFrameType(wide, data.FrameTypeTimeSeriesWide)
+	long := data.NewFrame("", data.NewField("time", nil, times), data.NewField("v", nil, values))
+	setFrameType(long, data.FrameTypeTimeSeriesLong)
+
+	frames := data.Frames{wide, long}
+	downsampleFrames(frames, 10, downsampleLTTB)
+	if frames[0].Rows() != 10 || len(frames[0].Meta.Notices) != 1 {
+		t.Errorf("wide frame: got %d rows and notices %v", frames[0].Rows(), frames[0].Meta.Notices)
+	}
+	if frames[1].Rows() != 50 {
+		t.Errorf("long frame: got %d rows, want 50", frames[1].Rows())
+	}
+}
+
+func containsRow(rows []int, row int) bool {
+	for _, r := range rows {
+		if r == row {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+package arrow_flightsql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// statusClientClosedRequest is the non-standard HTTP status 499 reported for
+// requests cancelled before they completed.
+const statusClientClosedRequest backend.Status = 499
+
+// grpcStatuses maps the gRPC status codes returned by the server to the status of the data response.
+var grpcStatuses = map[codes.Code]backend.Status{
+	codes.InvalidArgument:    backend.StatusBadRequest,
+	codes.FailedPrecondition: backend.StatusBadRequest,
+	codes.OutOfRange:         backend.StatusBadRequest,
+	codes.NotFound:           backend.StatusNotFound,
+	codes.AlreadyExists:      backend.StatusBadRequest,
+	codes.Unauthenticated:    backend.StatusUnauthorized,
+	codes.PermissionDenied:   backend.StatusForbidden,
+	codes.DeadlineExceeded:   backend.StatusTimeout,
+	codes.Canceled:           statusClientClosedRequest,
+	codes.Unavailable:        backend.StatusBadGateway,
+	codes.ResourceExhausted:  backend.StatusTooManyRequests,
+	codes.Unimplemented:      backend.StatusNotImplemented,
+}
+
+// serverError is an error returned by the Flight SQL server. Its message is
+// the one sent by the server, without the gRPC framing.
+type serverError struct {
+	status *status.Status
+}
+
+// newServerError returns err as a serverError when it carries a gRPC status,
+// and err unchanged otherwise.
+func newServerError(err error) error {
+	var se *serverError
+	if err == nil || errors.As(err, &se) {
+		return err
+	}
+	var gs interface{ GRPCStatus() *status.Status }
+	if !errors.As(err, &gs) || gs.GRPCStatus() == nil || gs.GRPCStatus().Code() == codes.OK {
+		return err
+	}
+	return &serverError{status: gs.GRPCStatus()}
+}
+
+func (e *serverError) Error() string {
+	msg := strings.TrimSpace(e.status.Message())
+	if msg == "" {
+		msg = e.status.Code().String()
+	}
+	for _, detail := range e.status.Details() {
+		switch d := detail.(type) {
+		case *errdetails.ErrorInfo:
+			msg += fmt.Sprintf(" (reason: %s)", d.GetReason())
+		case *errdetails.BadRequest:
+			for _, v := range d.GetFieldViolations() {
+				msg += fmt.Sprintf(" (%s: %s)", v.GetField(), v.GetDescription())
+			}
+		case *errdetails.LocalizedMessage:
+			msg += " " + d.GetMessage()
+		}
+	}
+	return msg
+}
+
+// GRPCStatus returns the status sent by the server.
+func (e *serverError) GRPCStatus() *status.Status {
+	return e.status
+}
+
+// errorResponse returns an error DataResponse for err. Errors returned by the
+// server are classified by their gRPC status code and marked as downstream
+// errors; any other error gets the fallback status.
+func errorResponse(err error, fallback backend.Status) backend.DataResponse {
+	if errors.Is(err, errReadOnly) {
+		return backend.ErrDataResponse(backend.StatusForbidden, err.Error())
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return backend.ErrDataResponseWithSource(backend.StatusTimeout, backend.ErrorSourceDownstream, err.Error())
+	}
+	if errors.Is(err, context.Canceled) {
+		return backend.ErrDataResponseWithSource(statusClientClosedRequest, backend.ErrorSourceDownstream, err.Error())
+	}
+	var se *serverError
+	if !errors.As(err, &se) {
+		return backend.ErrDataResponse(fallback, err.Error())
+	}
+	s, ok := grpcStatuses[se.status.Code()]
+	if !ok {
+		s = backend.StatusInternal
+	}
+	return backend.ErrDataResponseWithSource(s, backend.ErrorSourceDownstream, err.Error())
+}
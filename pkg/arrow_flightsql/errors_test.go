@@ -0,0 +1,75 @@
+package arrow_flightsql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestErrorResponse(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus backend.Status
+		// wantSource is empty for errors left to the default plugin source.
+		wantSource backend.ErrorSource
+	}{
+		{"invalid argument", status.Error(codes.InvalidArgument, "bad"), backend.StatusBadRequest, backend.ErrorSourceDownstream},
+		{"not found", status.Error(codes.NotFound, "no table"), backend.StatusNotFound, backend.ErrorSourceDownstream},
+		{"unauthenticated", status.Error(codes.Unauthenticated, "who"), backend.StatusUnauthorized, backend.ErrorSourceDownstream},
+		{"permission denied", status.Error(codes.PermissionDenied, "no"), backend.StatusForbidden, backend.ErrorSourceDownstream},
+		{"deadline exceeded", status.Error(codes.DeadlineExceeded, "slow"), backend.StatusTimeout, backend.ErrorSourceDownstream},
+		{"canceled", status.Error(codes.Canceled, "gone"), statusClientClosedRequest, backend.ErrorSourceDownstream},
+		{"unavailable", status.Error(codes.Unavailable, "down"), backend.StatusBadGateway, backend.ErrorSourceDownstream},
+		{"resource exhausted", status.Error(codes.ResourceExhausted, "busy"), backend.StatusTooManyRequests, backend.ErrorSourceDownstream},
+		{"unmapped code", status.Error(codes.DataLoss, "lost"), backend.StatusInternal, backend.ErrorSourceDownstream},
+		{"wrapped", fmt.Errorf("statement 2: %w", newServerError(status.Error(codes.NotFound, "no table"))), backend.StatusNotFound, backend.ErrorSourceDownstream},
+		{"context deadline", fmt.Errorf("query -> %w", context.DeadlineExceeded), backend.StatusTimeout, backend.ErrorSourceDownstream},
+		{"context canceled", context.Canceled, statusClientClosedRequest, backend.ErrorSourceDownstream},
+		{"read-only", fmt.Errorf("%w: DROP statements are not allowed", errReadOnly), backend.StatusForbidden, ""},
+		{"other", errors.New("conversion failed"), backend.StatusInternal, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := errorResponse(newServerError(tt.err), backend.StatusInternal)
+			if resp.Status != tt.wantStatus {
+				t.Errorf("got status %d, want %d", resp.Status, tt.wantStatus)
+			}
+			if resp.ErrorSource != tt.wantSource {
+				t.Errorf("got error source %q, want %q", resp.ErrorSource, tt.wantSource)
+			}
+		})
+	}
+}
+
+func TestServerErrorMessage(t *testing.T) {
+	st, err := status.New(codes.InvalidArgument, " syntax error at line 1 ").WithDetails(
+		&errdetails.ErrorInfo{Reason: "PARSE"},
+		&errdetails.BadRequest{FieldViolations: []*errdetails.BadRequest_FieldViolation{{Field: "sql", Description: "unexpected FROM"}}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := newServerError(st.Err())
+	want := "syntax error at line 1 (reason: PARSE) (sql: unexpected FROM)"
+	if got.Error() != want {
+		t.Errorf("got %q, want %q", got.Error(), want)
+	}
+	if status.Code(got) != codes.InvalidArgument {
+		t.Errorf("got code %s", status.Code(got))
+	}
+
+	if got := newServerError(status.Error(codes.Unavailable, "")); got.Error() != "Unavailable" {
+		t.Errorf("got %q for an empty message, want the code", got.Error())
+	}
+	plain := errors.New("plain")
+	if got := newServerError(plain); got != plain {
+		t.Errorf("got %v, want the error unchanged", got)
+	}
+}
@@ -0,0 +1,254 @@
+package arrow_flightsql
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/gtime"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/grafana-plugin-sdk-go/data/sqlutil"
+)
+
+const (
+	// defaultIncrementalOverlap is refetched before the end of the cached range to catch late data.
+	defaultIncrementalOverlap = time.Minute
+	// maxIncrementalCacheEntries bounds the number of queries cached per instance.
+	maxIncrementalCacheEntries = 500
+	// maxIncrementalCacheRows bounds the total number of rows cached per instance.
+	maxIncrementalCacheRows = 5_000_000
+	// incrementalCacheTTL is how long an entry is kept after its panel last refreshed.
+	incrementalCacheTTL = 10 * time.Minute
+)
+
+// incrementalQuery holds what is needed to refresh a query incrementally.
+type incrementalQuery struct {
+	// key identifies the panel query across refreshes.
+	key string
+	// fingerprint changes whenever anything but the time range of the query changes.
+	fingerprint string
+	overlap     time.Duration
+	// rangeSQL returns the query interpolated for another time range.
+	rangeSQL func(backend.TimeRange) (string, error)
+}
+
+// newIncrementalQuery returns the incremental refresh options of a query request.
+func newIncrementalQuery(q queryRequest, query sqlutil.Query, fingerprint string) (*incrementalQuery, error) {
+	overlap := defaultIncrementalOverlap
+	if q.IncrementalOverlap != "" {
+		var err error
+		if overlap, err = gtime.ParseDuration(q.IncrementalOverlap); err != nil {
+			return nil, fmt.Errorf("decodeQueryRequest IncrementalOverlap -> %w", err)
+		}
+	}
+	return &incrementalQuery{
+		fingerprint: fingerprint,
+		overlap:     overlap,
+		rangeSQL: func(tr backend.TimeRange) (string, error) {
+			query.RawSQL = q.Text
+			query.TimeRange = tr
+			statements, err := interpolateStatements(q, &query)
+			if err != nil {
+				return "", err
+			}
+			return statements[0], nil
+		},
+	}, nil
+}
+
+// incrementalEntry is the cached result of a query over a time range.
+type incrementalEntry struct {
+	fingerprint string
+	from, to    time.Time
+	frame       *data.Frame
+	lastUsed    time.Time
+}
+
+// incrementalCache keeps the results of queries refreshed incrementally. It
+// holds at most maxEntries entries and maxRows rows in total, and drops the
+// entries that were not used within ttl.
+type incrementalCache struct {
+	mu         sync.Mutex
+	entries    map[string]*incrementalEntry
+	rows       int
+	maxEntries int
+	maxRows    int
+	ttl        time.Duration
+}
+
+func newIncrementalCache() *incrementalCache {
+	return &incrementalCache{
+		entries:    make(map[string]*incrementalEntry),
+		maxEntries: maxIncrementalCacheEntries,
+		maxRows:    maxIncrementalCacheRows,
+		ttl:        incrementalCacheTTL,
+	}
+}
+
+func (c *incrementalCache) get(key string) *incrementalEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.expire(time.Now())
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	entry.lastUsed = time.Now()
+	return entry
+}
+
+// set stores an entry, evicting the least recently used ones while the cache
+// is full. Entries larger than the whole cache are not stored.
+func (c *incrementalCache) set(key string, entry *incrementalEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry.lastUsed = time.Now()
+	c.remove(key)
+	c.expire(entry.lastUsed)
+	if entry.frame.Rows() > c.maxRows {
+		return
+	}
+	for len(c.entries) >= c.maxEntries || c.rows+entry.frame.Rows() > c.maxRows {
+		var oldestKey string
+		var oldest time.Time
+		for k, e := range c.entries {
+			if oldestKey == "" || e.lastUsed.Before(oldest) {
+				oldestKey, oldest = k, e.lastUsed
+			}
+		}
+		c.remove(oldestKey)
+	}
+	c.entries[key] = entry
+	c.rows += entry.frame.Rows()
+}
+
+// expire removes the entries not used within the TTL.
+func (c *incrementalCache) expire(now time.Time) {
+	for k, e := range c.entries {
+		if now.Sub(e.lastUsed) > c.ttl {
+			c.remove(k)
+		}
+	}
+}
+
+func (c *incrementalCache) remove(key string) {
+	if e, ok := c.entries[key]; ok {
+		c.rows -= e.frame.Rows()
+		delete(c.entries, key)
+	}
+}
+
+// queryIncremental executes a query reusing the cached result of its previous
+// execution. Only the tail of the time range that is not cached, plus the
+// configured overlap, is fetched. A full query runs when nothing usable is cached.
+func (d *DataSource) queryIncremental(ctx context.Context, query queryModel) backend.DataResponse {
+	inc := query.Incremental
+	tr := query.TimeRange
+	stats := newQueryStats()
+
+	var frame *data.Frame
+	entry := d.incrementalCache.get(inc.key)
+	if entry != nil && entry.fingerprint == inc.fingerprint &&
+		!tr.From.Before(entry.from) && !tr.To.Before(entry.to) && tr.From.Before(entry.to) {
+		fetchFrom := tailStart(entry.to, inc.overlap, query.Interval, tr.From)
+		sql, err := inc.rangeSQL(backend.TimeRange{From: fetchFrom, To: tr.To})
+		if err != nil {
+			return backend.ErrDataResponse(backend.StatusBadRequest, err.Error())
+		}
+		tail, headers, err := d.fetchFrame(ctx, sql, stats)
+		if err != nil {
+			return errorResponse(err, backend.StatusInternal)
+		}
+		if frame, err = mergeTail(entry.frame, sortFrameByTime(tail), tr.From, fetchFrom); err == nil {
+			d.incrementalCache.set(inc.key, &incrementalEntry{fingerprint: inc.fingerprint, from: tr.From, to: tr.To, frame: frame})
+			d.observeCache(true)
+			query.RawSQL = sql
+			return newQueryDataResponse(ctx, shallowFrame(frame), query, headers, stats)
+		}
+		logErrorf("Incremental refresh failed, running full query: %s", err)
+		stats = newQueryStats()
+	}
+
+	d.observeCache(false)
+	frame, headers, err := d.fetchFrame(ctx, query.RawSQL, stats)
+	if err != nil {
+		return errorResponse(err, backend.StatusInternal)
+	}
+	frame = sortFrameByTime(frame)
+	if timeFieldIndex(frame) != -1 && !stats.rowLimitReached {
+		d.incrementalCache.set(inc.key, &incrementalEntry{fingerprint: inc.fingerprint, from: tr.From, to: tr.To, frame: frame})
+	}
+	return newQueryDataResponse(ctx, shallowFrame(frame), query, headers, stats)
+}
+
+// tailStart returns the start of the range refetched by an incremental
+// refresh: the overlap before the end of the cached range, rounded down to a
+// multiple of the interval so that a $__dateBin bucket is fetched whole
+// instead of being cached partially, but not before from.
+func tailStart(cachedTo time.Time, overlap, interval time.Duration, from time.Time) time.Time {
+	start := alignToInterval(cachedTo.Add(-overlap), interval)
+	if start.Before(from) {
+		return from
+	}
+	return start
+}
+
+// mergeTail returns the cached rows in [from, tailFrom) followed by the tail
+// rows at or after tailFrom, so that a bucket is taken either from the cache
+// or from the tail but never from both. Both frames must be sorted by time.
+func mergeTail(cached, tail *data.Frame, from, tailFrom time.Time) (*data.Frame, error) {
+	if len(cached.Fields) != len(tail.Fields) {
+		return nil, fmt.Errorf("schema changed: %d fields cached, %d fetched", len(cached.Fields), len(tail.Fields))
+	}
+	for i := range cached.Fields {
+		if cached.Fields[i].Name != tail.Fields[i].Name || cached.Fields[i].Type() != tail.Fields[i].Type() {
+			return nil, fmt.Errorf("schema changed at field %q", tail.Fields[i].Name)
+		}
+	}
+	timeIdx := timeFieldIndex(cached)
+	if timeIdx == -1 {
+		return nil, fmt.Errorf("no time field found")
+	}
+
+	var rows []int
+	for i := 0; i < cached.Rows(); i++ {
+		t, ok := cached.Fields[timeIdx].ConcreteAt(i)
+		if ok && !t.(time.Time).Before(from) && t.(time.Time).Before(tailFrom) {
+			rows = append(rows, i)
+		}
+	}
+	out := selectRows(cached, rows)
+	for i := 0; i < tail.Rows(); i++ {
+		if t, ok := tail.Fields[timeIdx].ConcreteAt(i); ok && t.(time.Time).Before(tailFrom) {
+			continue
+		}
+		for j, field := range tail.Fields {
+			out.Fields[j].Append(field.At(i))
+		}
+	}
+	out.Meta = &data.FrameMeta{}
+	return out, nil
+}
+
+// shallowFrame returns a frame sharing the fields of frame with fresh
+// metadata, so that formatting does not modify a cached frame. Notices are kept.
+func shallowFrame(frame *data.Frame) *data.Frame {
+	out := data.NewFrame(frame.Name, frame.Fields...)
+	out.Meta = &data.FrameMeta{}
+	if frame.Meta != nil {
+		out.Meta.Notices = frame.Meta.Notices
+	}
+	return out
+}
+
+// timeFieldIndex returns the index of the first time field of a frame, or -1.
+func timeFieldIndex(frame *data.Frame) int {
+	for i, field := range frame.Fields {
+		if field.Type().Time() {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,111 @@
+package arrow_flightsql
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+func cacheEntry(rows int) *incrementalEntry {
+	return &incrementalEntry{frame: data.NewFrame("", data.NewField("v", nil, make([]int64, rows)))}
+}
+
+func TestIncrementalCacheBounds(t *testing.T) {
+	c := newIncrementalCache()
+	c.maxEntries, c.maxRows = 2, 10
+
+	c.set("a", cacheEntry(4))
+	c.set("b", cacheEntry(4))
+	c.get("a")
+	c.set("c", cacheEntry(4))
+	if c.get("b") != nil {
+		t.Error("least recently used entry b was not evicted by the row bound")
+	}
+	if c.get("a") == nil || c.get("c") == nil {
+		t.Error("entries a and c were evicted")
+	}
+	if c.rows != 8 {
+		t.Errorf("got %d cached rows, want 8", c.rows)
+	}
+
+	c.set("a", cacheEntry(2))
+	if c.rows != 6 {
+		t.Errorf("got %d cached rows after replacing a, want 6", c.rows)
+	}
+
+	c.set("d", cacheEntry(11))
+	if c.get("d") != nil {
+		t.Error("entry larger than the cache was stored")
+	}
+}
+
+func TestIncrementalCacheTTL(t *testing.T) {
+	c := newIncrementalCache()
+	c.set("a", cacheEntry(1))
+	c.entries["a"].lastUsed = time.Now().Add(-c.ttl - time.Second)
+	if c.get("a") != nil {
+		t.Error("expired entry was returned")
+	}
+	if c.rows != 0 {
+		t.Errorf("got %d cached rows, want 0", c.rows)
+	}
+}
+
+func TestTailStart(t *testing.T) {
+	from := time.Date(2024, 1, 1, 11, 0, 0, 0, time.UTC)
+	cachedTo := time.Date(2024, 1, 1, 12, 0, 40, 0, time.UTC)
+	tests := []struct {
+		overlap, interval time.Duration
+		want              time.Time
+	}{
+		{overlap: 0, interval: 0, want: cachedTo},
+		{overlap: 0, interval: time.Minute, want: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)},
+		{overlap: time.Minute, interval: time.Minute, want: time.Date(2024, 1, 1, 11, 59, 0, 0, time.UTC)},
+		{overlap: time.Minute, interval: 5 * time.Minute, want: time.Date(2024, 1, 1, 11, 55, 0, 0, time.UTC)},
+		{overlap: 2 * time.Hour, interval: time.Minute, want: from},
+	}
+	for _, tt := range tests {
+		if got := tailStart(cachedTo, tt.overlap, tt.interval, from); !got.Equal(tt.want) {
+			t.Errorf("overlap %s, interval %s: got %s, want %s", tt.overlap, tt.interval, got, tt.want)
+		}
+	}
+}
+
+func TestMergeTail(t *testing.T) {
+	at := func(minute int) time.Time { return time.Date(2024, 1, 1, 12, minute, 0, 0, time.UTC) }
+	// The cache holds per-minute buckets; the 12:02 bucket was still filling
+	// when it was cached.
+	cached := data.NewFrame("",
+		data.NewField("time", nil, []time.Time{at(0), at(1), at(2)}),
+		data.NewField("count", nil, []int64{60, 60, 30}),
+	)
+	// The refresh refetches from the start of the 12:02 bucket.
+	tail := data.NewFrame("",
+		data.NewField("time", nil, []time.Time{at(1), at(2), at(3)}),
+		data.NewField("count", nil, []int64{0, 60, 10}),
+	)
+
+	out, err := mergeTail(cached, tail, at(1), at(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantTimes := []time.Time{at(1), at(2), at(3)}
+	wantCounts := []int64{60, 60, 10}
+	if out.Rows() != len(wantTimes) {
+		t.Fatalf("got %d rows, want %d", out.Rows(), len(wantTimes))
+	}
+	for i := range wantTimes {
+		if got := out.Fields[0].At(i).(time.Time); !got.Equal(wantTimes[i]) {
+			t.Errorf("row %d: got time %s, want %s", i, got, wantTimes[i])
+		}
+		if got := out.Fields[1].At(i).(int64); got != wantCounts[i] {
+			t.Errorf("row %d: got count %d, want %d", i, got, wantCounts[i])
+		}
+	}
+
+	changed := data.NewFrame("", data.NewField("time", nil, []time.Time{}), data.NewField("count", nil, []float64{}))
+	if _, err := mergeTail(cached, changed, at(1), at(2)); err == nil {
+		t.Error("got no error for a changed schema")
+	}
+}
@@ -2,6 +2,7 @@ package arrow_flightsql
 
 import (
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/grafana/grafana-plugin-sdk-go/data/sqlutil"
@@ -9,16 +10,33 @@ import (
 
 // Define macros with their corresponding functions.
 var macros = sqlutil.Macros{
-	"dateBin":        createMacroDateBin(""),
-	"dateBinAlias":   createMacroDateBin("_binned"),
-	"interval":       macroInterval,
-	"timeGroup":      macroTimeGroup,
-	"timeGroupAlias": macroTimeGroupAlias,
-	"timeRangeFrom":  sqlutil.DefaultMacros["timeFrom"],
-	"timeRangeTo":    sqlutil.DefaultMacros["timeTo"],
-	"timeRange":      sqlutil.DefaultMacros["timeFilter"],
-	"timeTo":         macroTo,
-	"timeFrom":       macroFrom,
+	"adhocFilters":        createMacroAdhocFilters(nil),
+	"dateBin":             createMacroDateBin(""),
+	"dateBinAlias":        createMacroDateBin("_binned"),
+	"interval":            macroInterval,
+	"interval_ms":         macroIntervalMs,
+	"interval_ns":         macroIntervalNs,
+	"timeGroup":           macroTimeGroup,
+	"timeGroupAlias":      macroTimeGroupAlias,
+	"timeRangeFrom":       sqlutil.DefaultMacros["timeFrom"],
+	"timeRangeTo":         sqlutil.DefaultMacros["timeTo"],
+	"timeRange":           sqlutil.DefaultMacros["timeFilter"],
+	"timeTo":              macroTo,
+	"timeFrom":            macroFrom,
+	"timeFilter":          macroTimeFilter,
+	"unixEpochFilter":     createMacroEpochFilter(time.Second),
+	"unixEpochMsFilter":   createMacroEpochFilter(time.Millisecond),
+	"unixEpochNanoFilter": createMacroEpochFilter(time.Nanosecond),
+}
+
+// macrosForRequest returns the macros bound to the options of a single query request.
+func macrosForRequest(q queryRequest) sqlutil.Macros {
+	m := make(sqlutil.Macros, len(macros))
+	for k, v := range macros {
+		m[k] = v
+	}
+	m["adhocFilters"] = createMacroAdhocFilters(q.AdhocFilters)
+	return m
 }
 
 // createMacroDateBin returns a macro function for date_bin.
@@ -29,7 +47,7 @@ func createMacroDateBin(suffix string) sqlutil.MacroFunc {
 		}
 		column := args[0]
 		alias := generateAlias(column, suffix)
-		return fmt.Sprintf("date_bin(interval '%d second', %s, timestamp '1970-01-01T00:00:00Z')%s", int64(query.Interval.Seconds()), column, alias), nil
+		return fmt.Sprintf("date_bin(%s, %s, timestamp '1970-01-01T00:00:00Z')%s", intervalLiteral(query.Interval), column, alias), nil
 	}
 }
 
@@ -53,17 +71,76 @@ func macroTimeGroupAlias(query *sqlutil.Query, args []string) (string, error) {
 
 // macroInterval generates the SQL for interval.
 func macroInterval(query *sqlutil.Query, _ []string) (string, error) {
-	return fmt.Sprintf("interval '%d second'", int64(query.Interval.Seconds())), nil
+	return intervalLiteral(query.Interval), nil
+}
+
+// macroIntervalMs generates the interval as a number of milliseconds.
+func macroIntervalMs(query *sqlutil.Query, _ []string) (string, error) {
+	return strconv.FormatInt(query.Interval.Milliseconds(), 10), nil
+}
+
+// macroIntervalNs generates the interval as a number of nanoseconds.
+func macroIntervalNs(query *sqlutil.Query, _ []string) (string, error) {
+	return strconv.FormatInt(query.Interval.Nanoseconds(), 10), nil
 }
 
 // macroFrom generates the SQL for the 'from' time range.
 func macroFrom(query *sqlutil.Query, _ []string) (string, error) {
-	return fmt.Sprintf("cast('%s' as timestamp)", query.TimeRange.From.Format(time.RFC3339)), nil
+	return timestampLiteral(query.TimeRange.From), nil
 }
 
 // macroTo generates the SQL for the 'to' time range.
 func macroTo(query *sqlutil.Query, _ []string) (string, error) {
-	return fmt.Sprintf("cast('%s' as timestamp)", query.TimeRange.To.Format(time.RFC3339)), nil
+	return timestampLiteral(query.TimeRange.To), nil
+}
+
+// intervalLiteral returns d as an interval literal in the largest of seconds,
+// milliseconds and nanoseconds that represents it exactly.
+func intervalLiteral(d time.Duration) string {
+	switch {
+	case d%time.Second == 0:
+		return fmt.Sprintf("interval '%d second'", d/time.Second)
+	case d%time.Millisecond == 0:
+		return fmt.Sprintf("interval '%d millisecond'", d/time.Millisecond)
+	default:
+		return fmt.Sprintf("interval '%d nanosecond'", d.Nanoseconds())
+	}
+}
+
+// macroTimeFilter generates a half-open filter on the time range for a timestamp column.
+func macroTimeFilter(query *sqlutil.Query, args []string) (string, error) {
+	if err := validateArgCount(args, 1); err != nil {
+		return "", err
+	}
+	column := args[0]
+	return fmt.Sprintf("%s >= %s AND %s < %s", column, timestampLiteral(query.TimeRange.From), column, timestampLiteral(query.TimeRange.To)), nil
+}
+
+// createMacroEpochFilter returns a macro function generating a half-open filter
+// on the time range for an integer column holding epoch times in the given unit.
+func createMacroEpochFilter(unit time.Duration) sqlutil.MacroFunc {
+	return func(query *sqlutil.Query, args []string) (string, error) {
+		if err := validateArgCount(args, 1); err != nil {
+			return "", err
+		}
+		column := args[0]
+		return fmt.Sprintf("%s >= %d AND %s < %d", column, epochCeil(query.TimeRange.From, unit), column, epochCeil(query.TimeRange.To, unit)), nil
+	}
+}
+
+// epochCeil returns the smallest epoch time in the given unit that is not before t.
+func epochCeil(t time.Time, unit time.Duration) int64 {
+	ns := t.UnixNano()
+	n := ns / int64(unit)
+	if ns%int64(unit) > 0 {
+		n++
+	}
+	return n
+}
+
+// timestampLiteral returns t as a UTC timestamp literal with nanosecond precision.
+func timestampLiteral(t time.Time) string {
+	return fmt.Sprintf("cast('%s' as timestamp)", t.UTC().Format(time.RFC3339Nano))
 }
 
 // validateArgCount checks if the number of arguments is as expected.
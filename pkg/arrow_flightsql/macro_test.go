@@ -0,0 +1,90 @@
+package arrow_flightsql
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data/sqlutil"
+)
+
+func TestIntervalLiteral(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{time.Minute, "interval '60 second'"},
+		{time.Second, "interval '1 second'"},
+		{250 * time.Millisecond, "interval '250 millisecond'"},
+		{1500 * time.Millisecond, "interval '1500 millisecond'"},
+		{100 * time.Nanosecond, "interval '100 nanosecond'"},
+		{1500 * time.Microsecond, "interval '1500000 nanosecond'"},
+	}
+	for _, tt := range tests {
+		if got := intervalLiteral(tt.d); got != tt.want {
+			t.Errorf("intervalLiteral(%s): got %s, want %s", tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestMacros(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 123456789, time.FixedZone("CET", 3600))
+	to := time.Date(2024, 1, 1, 1, 0, 0, 500000000, time.UTC)
+
+	tests := []struct {
+		name     string
+		sql      string
+		interval time.Duration
+		want     string
+	}{
+		{
+			name:     "interval",
+			sql:      "SELECT $__interval, $__interval_ms, $__interval_ns",
+			interval: 250 * time.Millisecond,
+			want:     "SELECT interval '250 millisecond', 250, 250000000",
+		},
+		{
+			name:     "sub-millisecond interval",
+			sql:      "SELECT $__interval_ms, $__interval_ns",
+			interval: 100 * time.Nanosecond,
+			want:     "SELECT 0, 100",
+		},
+		{
+			name:     "date bin",
+			sql:      "SELECT $__dateBin(time)",
+			interval: 1500 * time.Millisecond,
+			want:     "SELECT date_bin(interval '1500 millisecond', time, timestamp '1970-01-01T00:00:00Z')",
+		},
+		{
+			name: "time from and to",
+			sql:  "SELECT * FROM t WHERE time >= $__timeFrom AND time < $__timeTo",
+			want: "SELECT * FROM t WHERE time >= cast('2023-12-31T23:00:00.123456789Z' as timestamp) AND time < cast('2024-01-01T01:00:00.5Z' as timestamp)",
+		},
+		{
+			name: "time filter",
+			sql:  "SELECT * FROM t WHERE $__timeFilter(time)",
+			want: "SELECT * FROM t WHERE time >= cast('2023-12-31T23:00:00.123456789Z' as timestamp) AND time < cast('2024-01-01T01:00:00.5Z' as timestamp)",
+		},
+		{
+			name: "epoch filters",
+			sql:  "$__unixEpochFilter(s) $__unixEpochMsFilter(ms) $__unixEpochNanoFilter(ns)",
+			want: "s >= 1704063601 AND s < 1704070801 ms >= 1704063600124 AND ms < 1704070800500 ns >= 1704063600123456789 AND ns < 1704070800500000000",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := &sqlutil.Query{
+				RawSQL:    tt.sql,
+				Interval:  tt.interval,
+				TimeRange: backend.TimeRange{From: from, To: to},
+			}
+			got, err := interpolateStatements(queryRequest{Text: tt.sql}, query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got[0] != tt.want {
+				t.Errorf("got  %s\nwant %s", got[0], tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package arrow_flightsql
+
+import (
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data/sqlutil"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// metricsNamespace prefixes the metrics of the plugin.
+const metricsNamespace = "grafana_plugin_datalayers"
+
+// memoryCollector reports the Arrow memory allocated by each datasource instance.
+type memoryCollector struct {
+	desc       *prometheus.Desc
+	mu         sync.Mutex
+	allocators map[string]*trackingAllocator
+}
+
+var instanceMemory = &memoryCollector{
+	desc: prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "", "arrow_allocated_bytes"),
+		"Bytes of Arrow memory currently allocated by the queries of a datasource.",
+		[]string{"datasource_uid"}, nil,
+	),
+	allocators: make(map[string]*trackingAllocator),
+}
+
+var (
+	queriesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "queries_total",
+		Help:      "Number of queries executed, by format and status.",
+	}, []string{"datasource_uid", "format", "status"})
+	queryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "query_duration_seconds",
+		Help:      "Duration of queries, by format and status.",
+		Buckets:   []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"datasource_uid", "format", "status"})
+	rowsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "rows_total",
+		Help:      "Number of rows returned by the server.",
+	}, []string{"datasource_uid"})
+	bytesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "received_bytes_total",
+		Help:      "Number of Flight data bytes received from the server.",
+	}, []string{"datasource_uid"})
+	activeStreams = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "active_streams",
+		Help:      "Number of Grafana Live channels currently streamed.",
+	}, []string{"datasource_uid"})
+	cacheRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "incremental_cache_requests_total",
+		Help:      "Number of incremental refreshes, by whether the cached result was used.",
+	}, []string{"datasource_uid", "result"})
+	retriesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "retries_total",
+		Help:      "Number of calls retried after transient server errors.",
+	}, []string{"datasource_uid"})
+	authFailuresTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "auth_failures_total",
+		Help:      "Number of failed authentications and queries rejected as unauthenticated.",
+	}, []string{"datasource_uid"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		instanceMemory,
+		queriesTotal,
+		queryDuration,
+		rowsTotal,
+		bytesTotal,
+		activeStreams,
+		cacheRequestsTotal,
+		retriesTotal,
+		authFailuresTotal,
+	)
+}
+
+// formatLabel returns the metric label of a query format.
+func formatLabel(query queryModel) string {
+	if query.QueryType == queryTypeAnnotations {
+		return queryTypeAnnotations
+	}
+	switch query.Format {
+	case sqlutil.FormatOptionTable:
+		return "table"
+	case sqlutil.FormatOptionLogs:
+		return "logs"
+	default:
+		return "time_series"
+	}
+}
+
+// statusLabel returns the metric label of the status of a data response.
+func statusLabel(resp backend.DataResponse) string {
+	if resp.Error != nil {
+		return "error"
+	}
+	return "ok"
+}
+
+// observeQuery records the outcome of a query.
+func (d *DataSource) observeQuery(query queryModel, resp backend.DataResponse, elapsed time.Duration) {
+	format, status := formatLabel(query), statusLabel(resp)
+	queriesTotal.WithLabelValues(d.uid, format, status).Inc()
+	queryDuration.WithLabelValues(d.uid, format, status).Observe(elapsed.Seconds())
+	if resp.Status == backend.StatusUnauthorized {
+		authFailuresTotal.WithLabelValues(d.uid).Inc()
+	}
+}
+
+// observeStatement records the volume of a statement's result.
+func (d *DataSource) observeStatement(stats *queryStats) {
+	rowsTotal.WithLabelValues(d.uid).Add(float64(stats.rows))
+	bytesTotal.WithLabelValues(d.uid).Add(float64(stats.bytes))
+}
+
+// observeRetries records the retries of a call.
+func (d *DataSource) observeRetries(retries int) {
+	if retries > 0 {
+		retriesTotal.WithLabelValues(d.uid).Add(float64(retries))
+	}
+}
+
+// observeCache records whether an incremental refresh used the cached result.
+func (d *DataSource) observeCache(hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	cacheRequestsTotal.WithLabelValues(d.uid, result).Inc()
+}
+
+// add starts reporting the allocator of a datasource instance, replacing the
+// one of a previous instance of the same datasource.
+func (c *memoryCollector) add(uid string, alloc *trackingAllocator) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.allocators[uid] = alloc
+}
+
+// remove stops reporting the allocator of a disposed instance.
+func (c *memoryCollector) remove(uid string, alloc *trackingAllocator) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.allocators[uid] == alloc {
+		delete(c.allocators, uid)
+	}
+}
+
+func (c *memoryCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *memoryCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for uid, alloc := range c.allocators {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(alloc.CurrentAlloc()), uid)
+	}
+}
@@ -5,24 +5,81 @@ import (
 	"encoding/json"
 	"fmt"
 	"runtime/debug"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/apache/arrow/go/v12/arrow/flight"
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
 	"github.com/grafana/grafana-plugin-sdk-go/data"
 	"github.com/grafana/grafana-plugin-sdk-go/data/sqlutil"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc/metadata"
 )
 
 // queryRequest represents an inbound query request as part of a batch of queries sent to DataSource.QueryData.
 type queryRequest struct {
-	RefID                string `json:"refId"`
-	Text                 string `json:"queryText"`
-	IntervalMilliseconds int    `json:"intervalMs"`
-	MaxDataPoints        int64  `json:"maxDataPoints"`
-	Format               string `json:"format"`
+	RefID                string            `json:"refId"`
+	Text                 string            `json:"queryText"`
+	IntervalMilliseconds int               `json:"intervalMs"`
+	MaxDataPoints        int64             `json:"maxDataPoints"`
+	Format               string            `json:"format"`
+	TimeSeriesOutput     string            `json:"timeSeriesOutput"`
+	Alias                string            `json:"alias"`
+	AnnotationMapping    annotationMapping `json:"annotationMapping"`
+	AdhocFilters         []adhocFilter     `json:"adhocFilters"`
+	RawEditor            bool              `json:"rawEditor"`
+	SplitStatements      bool              `json:"splitStatements"`
+	Database             string            `json:"database"`
+	Headers              map[string]string `json:"headers"`
+	Downsample           string            `json:"downsample"`
+	SplitDuration        string            `json:"splitDuration"`
+	IncrementalCache     bool              `json:"incrementalCache"`
+	IncrementalOverlap   string            `json:"incrementalOverlap"`
+	builderQuery
 }
 
+// queryModel is a decoded query request with all macros expanded, along with
+// the per-query options that have no place in sqlutil.Query.
+type queryModel struct {
+	sqlutil.Query
+	QueryType         string
+	TimeSeriesOutput  timeSeriesOutput
+	Alias             string
+	AnnotationMapping annotationMapping
+	Downsample        downsampleMode
+	FromAlert         bool
+	// Statements holds the individual statements of a multi-statement query.
+	Statements []string
+	// Chunks holds one statement per time range chunk of a split query, in time order.
+	Chunks []string
+	// Incremental is set when the query is refreshed incrementally from a cache.
+	Incremental *incrementalQuery
+	// Metadata is sent as gRPC headers; the datasource metadata is used when nil.
+	Metadata metadata.MD
+}
+
+// timeSeriesOutput controls how long-format time series results are shaped.
+type timeSeriesOutput string
+
+const (
+	// timeSeriesOutputWide converts long results into a single wide frame.
+	timeSeriesOutputWide timeSeriesOutput = "wide"
+	// timeSeriesOutputMulti emits one frame per series with labels on the value field.
+	timeSeriesOutputMulti timeSeriesOutput = "multi"
+	// timeSeriesOutputLong leaves long results as they are returned by the server.
+	timeSeriesOutputLong timeSeriesOutput = "long"
+)
+
+const (
+	// headerFromAlert is set by Grafana on query requests issued by the alerting engine.
+	headerFromAlert = "FromAlert"
+	// headerDashboardUID and headerPanelID identify the panel a query request originates from.
+	headerDashboardUID = "X-Dashboard-Uid"
+	headerPanelID      = "X-Panel-Id"
+)
+
 // executeResult encapsulates concurrent query responses.
 type executeResult struct {
 	refID        string
@@ -33,12 +90,23 @@ type executeResult struct {
 func (d *DataSource) QueryData(ctx context.Context, req *backend.QueryDataRequest) (*backend.QueryDataResponse, error) {
 	response := backend.NewQueryDataResponse()
 	executeResults := make(chan executeResult, len(req.Queries))
+	fromAlert := req.Headers[headerFromAlert] == "true"
+	ctx = withQuerySource(ctx, req.GetHTTPHeader(headerDashboardUID), req.GetHTTPHeader(headerPanelID))
 	var wg sync.WaitGroup
 
+	if err := d.authenticate(ctx); err != nil {
+		for _, dataQuery := range req.Queries {
+			response.Responses[dataQuery.RefID] = errorResponse(err, backend.StatusInternal)
+		}
+		return response, nil
+	}
+
 	for _, dataQuery := range req.Queries {
-		query, err := decodeQueryRequest(dataQuery)
+		decodeCtx, span := startSpan(ctx, "datasource.decodeQuery", trace.WithAttributes(attribute.String("refId", dataQuery.RefID)))
+		query, err := d.decodeQueryRequest(decodeCtx, dataQuery)
+		endSpan(span, err)
 		if err != nil {
-			response.Responses[dataQuery.RefID] = backend.ErrDataResponse(backend.StatusBadRequest, err.Error())
+			response.Responses[dataQuery.RefID] = errorResponse(err, backend.StatusBadRequest)
 			continue
 		}
 		// Check query.RawSQL, An empty query returns an empty array
@@ -48,6 +116,14 @@ func (d *DataSource) QueryData(ctx context.Context, req *backend.QueryDataReques
 			}
 			continue
 		}
+		query.FromAlert = fromAlert
+		if query.Incremental != nil {
+			if fromAlert {
+				query.Incremental = nil
+			} else {
+				query.Incremental.key = fmt.Sprintf("%s/%s/%s", req.GetHTTPHeader(headerDashboardUID), req.GetHTTPHeader(headerPanelID), dataQuery.RefID)
+			}
+		}
 
 		wg.Add(1)
 		go d.executeQuery(ctx, query, executeResults, &wg)
@@ -62,13 +138,38 @@ func (d *DataSource) QueryData(ctx context.Context, req *backend.QueryDataReques
 	return response, nil
 }
 
-// decodeQueryRequest decodes a backend.DataQuery and returns a sqlutil.Query with all macros expanded.
-func decodeQueryRequest(dataQuery backend.DataQuery) (*sqlutil.Query, error) {
+// decodeQueryRequest decodes a backend.DataQuery and returns a queryModel with all macros expanded.
+// Queries from the query builder are compiled to SQL against the schema of the selected table.
+func (d *DataSource) decodeQueryRequest(ctx context.Context, dataQuery backend.DataQuery) (*queryModel, error) {
 	var q queryRequest
 	if err := json.Unmarshal(dataQuery.JSON, &q); err != nil {
 		return nil, fmt.Errorf("decodeQueryRequest Unmarshal -> %w", err)
 	}
 
+	overrides := make(map[string]string, len(q.Headers)+1)
+	for k, v := range q.Headers {
+		overrides[k] = v
+	}
+	if q.Database != "" {
+		overrides["database"] = q.Database
+	}
+	md, err := d.queryMetadata(overrides)
+	if err != nil {
+		return nil, fmt.Errorf("decodeQueryRequest Headers -> %w", err)
+	}
+
+	// Builder queries saved before the database schema was recorded keep the
+	// SQL built by the editor, as their table cannot be resolved reliably.
+	if !q.RawEditor && q.Table != "" && (q.DBSchema != "" || q.Text == "") {
+		schema, err := d.tableSchema(ctx, md, q.DBSchema, unquoteIdentifier(q.Table))
+		if err != nil {
+			return nil, fmt.Errorf("decodeQueryRequest TableSchema -> %w", err)
+		}
+		if q.Text, err = q.compile(schema); err != nil {
+			return nil, fmt.Errorf("decodeQueryRequest Builder -> %w", err)
+		}
+	}
+
 	format := formatQueryOptionFromString(q.Format)
 	query := &sqlutil.Query{
 		RawSQL:        q.Text,
@@ -79,17 +180,68 @@ func decodeQueryRequest(dataQuery backend.DataQuery) (*sqlutil.Query, error) {
 		Format:        format,
 	}
 
-	sql, err := sqlutil.Interpolate(query, macros)
+	statements, err := interpolateStatements(q, query)
 	if err != nil {
-		return nil, fmt.Errorf("decodeQueryRequest Interpolate -> %w", err)
+		return nil, err
 	}
-	query.RawSQL = sql
+	query.RawSQL = strings.Join(statements, ";\n")
 
-	return query, nil
+	model := &queryModel{
+		Query:             *query,
+		QueryType:         dataQuery.QueryType,
+		TimeSeriesOutput:  timeSeriesOutputFromString(q.TimeSeriesOutput),
+		Alias:             q.Alias,
+		AnnotationMapping: q.AnnotationMapping,
+		Downsample:        downsampleModeFromString(q.Downsample),
+		Metadata:          md,
+	}
+	if q.SplitStatements {
+		model.Statements = statements
+	}
+	if q.SplitDuration != "" {
+		if q.SplitStatements {
+			return nil, fmt.Errorf("time range splitting cannot be combined with multiple statements")
+		}
+		if model.Chunks, err = timeRangeChunks(q, query); err != nil {
+			return nil, err
+		}
+	}
+	if q.IncrementalCache {
+		if q.SplitStatements || q.SplitDuration != "" {
+			return nil, fmt.Errorf("incremental caching cannot be combined with multiple statements or time range splitting")
+		}
+		if model.Incremental, err = newIncrementalQuery(q, *query, string(dataQuery.JSON)); err != nil {
+			return nil, err
+		}
+	}
+	return model, nil
+}
+
+// interpolateStatements expands the macros of a query, splits it into
+// statements if requested and applies the ad-hoc filters to each statement.
+func interpolateStatements(q queryRequest, query *sqlutil.Query) ([]string, error) {
+	sql, err := sqlutil.Interpolate(query, macrosForRequest(q))
+	if err != nil {
+		return nil, fmt.Errorf("decodeQueryRequest Interpolate -> %w", err)
+	}
+	statements := []string{sql}
+	if q.SplitStatements {
+		statements = splitStatements(sql)
+	}
+	// Filters are applied by the $__adhocFilters macro when the query uses it,
+	// otherwise each statement is filtered as a subquery.
+	if len(q.AdhocFilters) > 0 && !strings.Contains(q.Text, "$__adhocFilters") {
+		for i, stmt := range statements {
+			if statements[i], err = wrapWithAdhocFilters(stmt, q.AdhocFilters); err != nil {
+				return nil, fmt.Errorf("decodeQueryRequest AdhocFilters -> %w", err)
+			}
+		}
+	}
+	return statements, nil
 }
 
 // executeQuery executes a single query in a goroutine and sends the result to the executeResults channel.
-func (d *DataSource) executeQuery(ctx context.Context, query *sqlutil.Query, executeResults chan<- executeResult, wg *sync.WaitGroup) {
+func (d *DataSource) executeQuery(ctx context.Context, query *queryModel, executeResults chan<- executeResult, wg *sync.WaitGroup) {
 	defer wg.Done()
 	executeResults <- executeResult{
 		refID:        query.RefID,
@@ -98,7 +250,16 @@ func (d *DataSource) executeQuery(ctx context.Context, query *sqlutil.Query, exe
 }
 
 // query executes a SQL statement by issuing a CommandStatementQuery command to Flight SQL.
-func (d *DataSource) query(ctx context.Context, query sqlutil.Query) (response backend.DataResponse) {
+func (d *DataSource) query(ctx context.Context, query queryModel) (response backend.DataResponse) {
+	start := time.Now()
+	ctx, span := startSpan(ctx, "datasource.query", trace.WithAttributes(
+		attribute.String("refId", query.RefID),
+		attribute.String("format", formatLabel(query)),
+	))
+	defer func() {
+		endSpan(span, response.Error)
+		d.observeQuery(query, response, time.Since(start))
+	}()
 	defer func(response *backend.DataResponse) {
 		if r := recover(); r != nil {
 			logErrorf("Panic: %s %s", r, string(debug.Stack()))
@@ -106,29 +267,152 @@ func (d *DataSource) query(ctx context.Context, query sqlutil.Query) (response b
 		}
 	}(&response)
 
-	if d.md.Len() != 0 {
-		ctx = metadata.NewOutgoingContext(ctx, d.md)
+	ctx = d.outgoingContext(ctx, query.Metadata)
+	if len(query.Statements) > 1 {
+		return d.queryStatements(ctx, query)
+	}
+	if len(query.Chunks) > 1 {
+		return d.queryChunks(ctx, query)
+	}
+	if query.Incremental != nil {
+		return d.queryIncremental(ctx, query)
+	}
+	return d.queryStatement(ctx, query)
+}
+
+// outgoingContext attaches the gRPC headers of a query to ctx, falling back to
+// the datasource metadata when md is nil.
+func (d *DataSource) outgoingContext(ctx context.Context, md metadata.MD) context.Context {
+	if md == nil {
+		md = d.md
+	}
+	if md.Len() != 0 {
+		ctx = metadata.NewOutgoingContext(ctx, md)
+	}
+	return ctx
+}
+
+// queryStatements executes the statements of a multi-statement query one after
+// another and returns one frame per statement. Execution stops at the first
+// failing statement; frames of the statements before it are kept.
+func (d *DataSource) queryStatements(ctx context.Context, query queryModel) backend.DataResponse {
+	var response backend.DataResponse
+	response.Frames = data.Frames{}
+	for i, stmt := range query.Statements {
+		q := query
+		q.RawSQL = stmt
+		q.Statements = nil
+
+		resp := d.queryStatement(ctx, q)
+		response.Frames = append(response.Frames, resp.Frames...)
+		if resp.Error != nil {
+			response.Error = fmt.Errorf("statement %d: %w", i+1, resp.Error)
+			response.Status = resp.Status
+			response.ErrorSource = resp.ErrorSource
+			return response
+		}
+	}
+	return response
+}
+
+// queryStatement executes a single SQL statement.
+func (d *DataSource) queryStatement(ctx context.Context, query queryModel) backend.DataResponse {
+	stats := newQueryStats()
+	frame, headers, err := d.fetchFrame(ctx, query.RawSQL, stats)
+	if err != nil {
+		return errorResponse(err, backend.StatusInternal)
 	}
+	return newQueryDataResponse(ctx, frame, query, headers, stats)
+}
 
-	info, err := d.client.Execute(ctx, query.RawSQL)
+// fetchFrame executes a SQL statement by issuing a CommandStatementQuery
+// command to Flight SQL and converts the result into a single frame. The
+// number of statements executing at once is bounded by the instance's limit.
+func (d *DataSource) fetchFrame(ctx context.Context, sql string, stats *queryStats) (frame *data.Frame, headers metadata.MD, err error) {
+	if d.audit != nil {
+		defer func() { d.auditStatement(ctx, sql, stats, err) }()
+	}
+	// Only statements that read data are retried: the server may already have
+	// applied a write when the call fails.
+	retry := withRetry
+	if err := checkReadOnly(sql); err != nil {
+		if d.readOnly {
+			return nil, nil, err
+		}
+		retry = withoutRetry
+	}
+
+	select {
+	case d.queryLimiter <- struct{}{}:
+		defer func() { <-d.queryLimiter }()
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	}
+	// The timings of the statement start once it may run, so that they do not
+	// include the time spent waiting for other statements.
+	stats.start = time.Now()
+
+	var info *flight.FlightInfo
+	infoCtx, span := startSpan(ctx, "flightsql.GetFlightInfo")
+	retries, err := retry(infoCtx, func() (err error) {
+		info, err = d.client.Execute(infoCtx, sql)
+		return err
+	})
+	span.SetAttributes(attribute.Int("retries", retries))
+	endSpan(span, err)
+	stats.retries += int64(retries)
+	d.observeRetries(retries)
 	if err != nil {
-		return backend.ErrDataResponse(backend.StatusInternal, fmt.Sprintf("[FlightSQL Error] %s", err))
+		return nil, nil, newServerError(err)
 	}
+	stats.flightInfoDuration = time.Since(stats.start)
+	stats.totalRecords = info.TotalRecords
+	stats.totalBytes = info.TotalBytes
 	if len(info.Endpoint) != 1 {
-		return backend.ErrDataResponse(backend.StatusInternal, fmt.Sprintf("unsupported endpoint count in response: %d", len(info.Endpoint)))
+		return nil, nil, fmt.Errorf("unsupported endpoint count in response: %d", len(info.Endpoint))
 	}
-	reader, err := d.client.DoGetWithHeaderExtraction(ctx, info.Endpoint[0].Ticket)
+	// The stream can be retried until its schema is read; after that rows
+	// may already have been consumed.
+	getCtx, getSpan := startSpan(ctx, "flightsql.DoGet")
+	defer func() {
+		getSpan.SetAttributes(attribute.Int64("bytes", stats.bytes))
+		endSpan(getSpan, err)
+	}()
+	alloc, checkLeaks := d.statementAllocator()
+	var reader *flightReader
+	retries, err = retry(getCtx, func() (err error) {
+		reader, err = d.client.DoGetWithHeaderExtraction(getCtx, info.Endpoint[0].Ticket, alloc)
+		return err
+	})
+	getSpan.SetAttributes(attribute.Int("retries", retries))
+	stats.retries += int64(retries)
+	d.observeRetries(retries)
 	if err != nil {
-		return backend.ErrDataResponse(backend.StatusInternal, fmt.Sprintf("[FlightSQL Error]%s", err))
+		return nil, nil, newServerError(err)
 	}
-	defer reader.Release()
+	defer func() {
+		reader.Release()
+		if leakErr := checkLeaks(); leakErr != nil && err == nil {
+			frame, headers, err = nil, nil, leakErr
+		}
+	}()
 
-	headers, err := reader.Header()
+	headers, err = reader.Header()
 	if err != nil {
 		logErrorf("Failed to extract headers: %s", err)
 	}
 
-	return newQueryDataResponse(reader, query, headers)
+	_, convertSpan := startSpan(getCtx, "datasource.convert")
+	frame, err = frameForRecords(reader, stats, d.alloc, d.conversionWorkers)
+	convertSpan.SetAttributes(attribute.Int64("rows", stats.rows), attribute.Int64("batches", stats.batches))
+	endSpan(convertSpan, err)
+	if err != nil {
+		return nil, nil, newServerError(err)
+	}
+	stats.bytes = reader.BytesRead()
+	d.observeStatement(stats)
+	d.reportSlowStatement(ctx, frame, sql, stats)
+	return frame, headers, nil
 }
 
 // formatQueryOptionFromString returns the format query option based on the provided format string.
@@ -140,3 +424,15 @@ func formatQueryOptionFromString(format string) sqlutil.FormatQueryOption {
 		return sqlutil.FormatOptionTimeSeries
 	}
 }
+
+// timeSeriesOutputFromString returns the time series output mode based on the provided string.
+func timeSeriesOutputFromString(output string) timeSeriesOutput {
+	switch output {
+	case string(timeSeriesOutputMulti):
+		return timeSeriesOutputMulti
+	case string(timeSeriesOutputLong):
+		return timeSeriesOutputLong
+	default:
+		return timeSeriesOutputWide
+	}
+}
@@ -0,0 +1,85 @@
+package arrow_flightsql
+
+import (
+	"errors"
+	"fmt"
+)
+
+var errReadOnly = errors.New("the datasource is read-only")
+
+// readOnlyStatements are the statements allowed in read-only mode, by their first keyword.
+var readOnlyStatements = map[string]struct{}{
+	"SELECT":   {},
+	"WITH":     {},
+	"SHOW":     {},
+	"EXPLAIN":  {},
+	"DESCRIBE": {},
+	"DESC":     {},
+}
+
+// writeKeywords may not appear anywhere in a read-only statement. They catch
+// data-modifying CTEs, EXPLAIN ANALYZE of writes and SELECT ... INTO.
+var writeKeywords = map[string]struct{}{
+	"INSERT":   {},
+	"UPDATE":   {},
+	"DELETE":   {},
+	"MERGE":    {},
+	"UPSERT":   {},
+	"CREATE":   {},
+	"DROP":     {},
+	"ALTER":    {},
+	"TRUNCATE": {},
+	"RENAME":   {},
+	"GRANT":    {},
+	"REVOKE":   {},
+	"COPY":     {},
+	"INTO":     {},
+	"FLUSH":    {},
+	"COMPACT":  {},
+}
+
+// readOnlyLexers are the lexical rules of the SQL dialects a statement may be
+// read with. A statement is only read-only when it is read-only under every
+// one of them, so that quotes or comments the server reads differently cannot
+// hide another statement, as in SELECT '\'; DROP TABLE t; --'.
+var readOnlyLexers = func() []sqlLexer {
+	var lexers []sqlLexer
+	for _, backslashEscapes := range []bool{false, true} {
+		for _, dollarQuotes := range []bool{false, true} {
+			for _, dashCommentSpace := range []bool{false, true} {
+				lexers = append(lexers, sqlLexer{backslashEscapes: backslashEscapes, dollarQuotes: dollarQuotes, dashCommentSpace: dashCommentSpace})
+			}
+		}
+	}
+	return lexers
+}()
+
+// checkReadOnly returns an error unless every statement of sql only reads data.
+func checkReadOnly(sql string) error {
+	for _, l := range readOnlyLexers {
+		if err := l.checkReadOnly(sql); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkReadOnly returns an error unless every statement of sql, as read by l,
+// only reads data.
+func (l sqlLexer) checkReadOnly(sql string) error {
+	for _, stmt := range l.statements(sql) {
+		keywords := l.keywords(stmt)
+		if len(keywords) == 0 {
+			continue
+		}
+		if _, ok := readOnlyStatements[keywords[0]]; !ok {
+			return fmt.Errorf("%w: %s statements are not allowed", errReadOnly, keywords[0])
+		}
+		for _, k := range keywords[1:] {
+			if _, ok := writeKeywords[k]; ok {
+				return fmt.Errorf("%w: %s is not allowed", errReadOnly, k)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package arrow_flightsql
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckReadOnly(t *testing.T) {
+	tests := []struct {
+		name    string
+		sql     string
+		allowed bool
+	}{
+		{name: "select", sql: "SELECT * FROM t WHERE a = 1", allowed: true},
+		{name: "lower case", sql: "select * from t", allowed: true},
+		{name: "show", sql: "SHOW TABLES", allowed: true},
+		{name: "describe", sql: "DESC t", allowed: true},
+		{name: "explain", sql: "EXPLAIN SELECT * FROM t", allowed: true},
+		{name: "cte", sql: "WITH x AS (SELECT 1) SELECT * FROM x", allowed: true},
+		{name: "insert", sql: "INSERT INTO t VALUES (1)"},
+		{name: "leading comment", sql: "/* report */ -- daily\nDROP TABLE t"},
+		{name: "cte with insert", sql: "WITH x AS (INSERT INTO t VALUES (1) RETURNING *) SELECT * FROM x"},
+		{name: "cte with delete", sql: "WITH x AS (SELECT 1) DELETE FROM t"},
+		{name: "explain analyze write", sql: "EXPLAIN ANALYZE UPDATE t SET a = 1"},
+		{name: "select into", sql: "SELECT * INTO backup FROM t"},
+		{name: "multiple statements", sql: "SELECT 1; SELECT 2;", allowed: true},
+		{name: "second statement writes", sql: "SELECT 1; DROP TABLE t"},
+		{name: "no space before statement", sql: "SELECT 1;DROP TABLE t"},
+		{name: "keyword in string", sql: "SELECT 'DROP TABLE t; DELETE' AS s", allowed: true},
+		{name: "keyword in doubled quotes", sql: "SELECT 'it''s; DROP TABLE t' AS s", allowed: true},
+		{name: "keyword in quoted identifier", sql: `SELECT "delete", "into" FROM "update"`, allowed: true},
+		{name: "keyword in backquotes", sql: "SELECT `delete` FROM `drop;table`", allowed: true},
+		{name: "keyword in comment", sql: "SELECT 1 -- DROP TABLE t\n/* ; DELETE FROM t */", allowed: true},
+		{name: "keyword in column name", sql: "SELECT updated_at, insert_count FROM t", allowed: true},
+		{name: "escape string hides statement", sql: `SELECT E'\''; DROP TABLE t; --'`},
+		{name: "escape string", sql: `SELECT E'it\'s' AS s`, allowed: true},
+		{name: "backslash hides statement", sql: `SELECT 'a\'; DROP TABLE t; --'`},
+		{name: "backslash revealed statement", sql: `SELECT 'a\' ; DROP TABLE t; --'`},
+		{name: "backslash in string", sql: `SELECT 'C:\temp' AS path`, allowed: true},
+		{name: "dollar quote hides statement", sql: "SELECT $$'$$; DROP TABLE t; --'"},
+		{name: "dollar quote", sql: "SELECT $tag$ DROP TABLE t $tag$", allowed: false},
+		{name: "dash without space", sql: "SELECT 1 --1; DROP TABLE t"},
+		{name: "unterminated string", sql: "SELECT 'DROP TABLE t", allowed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkReadOnly(tt.sql)
+			if tt.allowed && err != nil {
+				t.Errorf("got error %v, want the statement allowed", err)
+			}
+			if !tt.allowed && !errors.Is(err, errReadOnly) {
+				t.Errorf("got error %v, want %v", err, errReadOnly)
+			}
+		})
+	}
+}
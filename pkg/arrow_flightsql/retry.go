@@ -0,0 +1,95 @@
+package arrow_flightsql
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/apache/arrow/go/v12/arrow/flight"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxRetries bounds the number of times a call is retried.
+const maxRetries = 5
+
+// The backoff delays are variables so that tests can shorten them.
+var (
+	// retryBaseDelay is the backoff before the first retry; it doubles with every retry.
+	retryBaseDelay = 100 * time.Millisecond
+	// retryMaxDelay caps the backoff between two attempts.
+	retryMaxDelay = 5 * time.Second
+)
+
+// retryable reports whether err is a transient server error after which an
+// idempotent call may be repeated.
+func retryable(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.ResourceExhausted:
+		return true
+	default:
+		return false
+	}
+}
+
+// withRetry calls fn until it succeeds or fails with an error that is not
+// retryable. Attempts are spaced by an exponential backoff with full jitter.
+// Retrying stops after maxRetries, or when the next attempt would start after
+// the deadline of ctx. It returns the number of retries.
+func withRetry(ctx context.Context, fn func() error) (int, error) {
+	delay := retryBaseDelay
+	for retries := 0; ; retries++ {
+		err := fn()
+		if err == nil || !retryable(err) || retries == maxRetries {
+			return retries, err
+		}
+
+		wait := time.Duration(rand.Int63n(int64(delay)) + 1)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return retries, err
+		}
+		logWarnf("Retrying after transient error in %s: %s", wait, err)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return retries, err
+		case <-timer.C:
+		}
+		if delay *= 2; delay > retryMaxDelay {
+			delay = retryMaxDelay
+		}
+	}
+}
+
+// withoutRetry calls fn once. It replaces withRetry for calls that are not
+// idempotent.
+func withoutRetry(_ context.Context, fn func() error) (int, error) {
+	return 0, fn()
+}
+
+// fetchMetadata retrieves the FlightInfo of a metadata command with getInfo
+// and starts reading its only endpoint, retrying transient failures of both calls.
+func (d *DataSource) fetchMetadata(ctx context.Context, getInfo func() (*flight.FlightInfo, error)) (*flight.Reader, error) {
+	var info *flight.FlightInfo
+	retries, err := withRetry(ctx, func() (err error) {
+		info, err = getInfo()
+		return err
+	})
+	d.observeRetries(retries)
+	if err != nil {
+		return nil, newServerError(err)
+	}
+
+	var reader *flight.Reader
+	retries, err = withRetry(ctx, func() (err error) {
+		reader, err = d.client.DoGet(ctx, info.Endpoint[0].Ticket)
+		return err
+	})
+	d.observeRetries(retries)
+	if err != nil {
+		return nil, newServerError(err)
+	}
+	return reader, nil
+}
@@ -0,0 +1,101 @@
+package arrow_flightsql
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow/go/v12/arrow/memory"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// shortRetryDelays shortens the retry backoff for the duration of a test.
+func shortRetryDelays(t *testing.T, base time.Duration) {
+	oldBase, oldMax := retryBaseDelay, retryMaxDelay
+	retryBaseDelay, retryMaxDelay = base, base
+	t.Cleanup(func() { retryBaseDelay, retryMaxDelay = oldBase, oldMax })
+}
+
+// failing returns a call failing with err n times before it succeeds, and a
+// pointer to its number of calls.
+func failing(n int, err error) (func() error, *int) {
+	calls := 0
+	return func() error {
+		calls++
+		if calls <= n {
+			return err
+		}
+		return nil
+	}, &calls
+}
+
+func TestWithRetry(t *testing.T) {
+	shortRetryDelays(t, time.Millisecond)
+	unavailable := status.Error(codes.Unavailable, "restarting")
+
+	tests := []struct {
+		name        string
+		failures    int
+		err         error
+		wantRetries int
+		wantErr     bool
+	}{
+		{name: "success", failures: 0, err: unavailable, wantRetries: 0},
+		{name: "transient", failures: 2, err: unavailable, wantRetries: 2},
+		{name: "overloaded", failures: 1, err: status.Error(codes.ResourceExhausted, "busy"), wantRetries: 1},
+		{name: "attempt cap", failures: maxRetries + 1, err: unavailable, wantRetries: maxRetries, wantErr: true},
+		{name: "not retryable", failures: 1, err: status.Error(codes.InvalidArgument, "bad"), wantRetries: 0, wantErr: true},
+		{name: "not a server error", failures: 1, err: errors.New("closed"), wantRetries: 0, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fn, calls := failing(tt.failures, tt.err)
+			retries, err := withRetry(context.Background(), fn)
+			if retries != tt.wantRetries || *calls != tt.wantRetries+1 {
+				t.Errorf("got %d retries and %d calls, want %d retries", retries, *calls, tt.wantRetries)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error %v", err)
+			}
+		})
+	}
+}
+
+func TestWithRetryDeadline(t *testing.T) {
+	// No backoff fits before the deadline, so the first error is returned.
+	shortRetryDelays(t, time.Hour)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+
+	fn, calls := failing(1, status.Error(codes.Unavailable, "restarting"))
+	retries, err := withRetry(ctx, fn)
+	if retries != 0 || *calls != 1 || err == nil {
+		t.Errorf("got %d retries, %d calls and error %v", retries, *calls, err)
+	}
+}
+
+func TestFetchFrameRetriesOnlyReads(t *testing.T) {
+	shortRetryDelays(t, time.Millisecond)
+	srv := &testServer{mem: memory.NewGoAllocator(), batches: 1, rows: 1}
+	ds, _ := startTestDataSource(t, srv)
+
+	srv.unavailable.Store(1)
+	stats := newQueryStats()
+	if _, _, err := ds.fetchFrame(context.Background(), "SELECT * FROM demo", stats); err != nil {
+		t.Fatal(err)
+	}
+	if got := srv.statements.Load(); got != 2 || stats.retries != 1 {
+		t.Errorf("read: got %d statements and %d retries, want 2 and 1", got, stats.retries)
+	}
+
+	srv.statements.Store(0)
+	srv.unavailable.Store(1)
+	if _, _, err := ds.fetchFrame(context.Background(), "INSERT INTO demo VALUES (1)", newQueryStats()); status.Code(err) != codes.Unavailable {
+		t.Errorf("write: got error %v, want unavailable", err)
+	}
+	if got := srv.statements.Load(); got != 1 {
+		t.Errorf("write: got %d statements, want 1", got)
+	}
+}
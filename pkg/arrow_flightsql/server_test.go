@@ -0,0 +1,160 @@
+package arrow_flightsql
+
+import (
+	"context"
+	"encoding/json"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/array"
+	"github.com/apache/arrow/go/v12/arrow/flight"
+	"github.com/apache/arrow/go/v12/arrow/flight/flightsql"
+	"github.com/apache/arrow/go/v12/arrow/flight/flightsql/schema_ref"
+	"github.com/apache/arrow/go/v12/arrow/memory"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// testSchema is the schema of the rows returned by testServer for every statement.
+var testSchema = arrow.NewSchema([]arrow.Field{
+	{Name: "time", Type: &arrow.TimestampType{Unit: arrow.Nanosecond}},
+	{Name: "host", Type: arrow.BinaryTypes.String, Nullable: true},
+	{Name: "value", Type: arrow.PrimitiveTypes.Float64, Nullable: true},
+}, nil)
+
+// testServer is a Flight SQL server returning the same rows, in batches, for
+// every statement, and a single table "demo" with testSchema.
+type testServer struct {
+	flightsql.BaseServer
+	mem     memory.Allocator
+	batches int
+	rows    int
+	// unavailable is the number of statements still to reject as unavailable.
+	unavailable atomic.Int32
+	// statements counts the statements received.
+	statements atomic.Int32
+}
+
+func (s *testServer) GetFlightInfoStatement(_ context.Context, cmd flightsql.StatementQuery, desc *flight.FlightDescriptor) (*flight.FlightInfo, error) {
+	s.statements.Add(1)
+	if s.unavailable.Add(-1) >= 0 {
+		return nil, status.Error(codes.Unavailable, "server restarting")
+	}
+	ticket, err := flightsql.CreateStatementQueryTicket([]byte(cmd.GetQuery()))
+	if err != nil {
+		return nil, err
+	}
+	return &flight.FlightInfo{
+		FlightDescriptor: desc,
+		Endpoint:         []*flight.FlightEndpoint{{Ticket: &flight.Ticket{Ticket: ticket}}},
+		TotalRecords:     int64(s.batches * s.rows),
+		TotalBytes:       -1,
+	}, nil
+}
+
+func (s *testServer) DoGetStatement(context.Context, flightsql.StatementQueryTicket) (*arrow.Schema, <-chan flight.StreamChunk, error) {
+	ch := make(chan flight.StreamChunk, s.batches)
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for b := 0; b < s.batches; b++ {
+		bldr := array.NewRecordBuilder(s.mem, testSchema)
+		for i := 0; i < s.rows; i++ {
+			n := b*s.rows + i
+			bldr.Field(0).(*array.TimestampBuilder).Append(arrow.Timestamp(t0.Add(time.Duration(n) * time.Second).UnixNano()))
+			bldr.Field(1).(*array.StringBuilder).Append([]string{"a", "b"}[n%2])
+			bldr.Field(2).(*array.Float64Builder).Append(float64(n))
+		}
+		ch <- flight.StreamChunk{Data: bldr.NewRecord()}
+		bldr.Release()
+	}
+	close(ch)
+	return testSchema, ch, nil
+}
+
+func (s *testServer) GetFlightInfoTables(_ context.Context, _ flightsql.GetTables, desc *flight.FlightDescriptor) (*flight.FlightInfo, error) {
+	return &flight.FlightInfo{
+		FlightDescriptor: desc,
+		Endpoint:         []*flight.FlightEndpoint{{Ticket: &flight.Ticket{Ticket: desc.Cmd}}},
+		TotalRecords:     -1,
+		TotalBytes:       -1,
+	}, nil
+}
+
+func (s *testServer) DoGetTables(_ context.Context, cmd flightsql.GetTables) (*arrow.Schema, <-chan flight.StreamChunk, error) {
+	schema := schema_ref.Tables
+	if cmd.GetIncludeSchema() {
+		schema = schema_ref.TablesWithIncludedSchema
+	}
+	bldr := array.NewRecordBuilder(s.mem, schema)
+	defer bldr.Release()
+	bldr.Field(0).(*array.StringBuilder).AppendNull()
+	bldr.Field(1).(*array.StringBuilder).Append("public")
+	bldr.Field(2).(*array.StringBuilder).Append("demo")
+	bldr.Field(3).(*array.StringBuilder).Append("table")
+	if cmd.GetIncludeSchema() {
+		bldr.Field(4).(*array.BinaryBuilder).Append(flight.SerializeSchema(testSchema, s.mem))
+	}
+
+	ch := make(chan flight.StreamChunk, 1)
+	ch <- flight.StreamChunk{Data: bldr.NewRecord()}
+	close(ch)
+	return schema, ch, nil
+}
+
+// newTestDataSource starts a testServer and returns a datasource connected to
+// it whose Arrow memory is allocated by a checked allocator.
+func newTestDataSource(t testing.TB, batches, rows int) (*DataSource, *memory.CheckedAllocator) {
+	t.Helper()
+	return startTestDataSource(t, &testServer{mem: memory.NewGoAllocator(), batches: batches, rows: rows})
+}
+
+// startTestDataSource starts srv and returns a datasource connected to it
+// whose Arrow memory is allocated by a checked allocator.
+func startTestDataSource(t testing.TB, srv *testServer) (*DataSource, *memory.CheckedAllocator) {
+	t.Helper()
+	if err := srv.RegisterSqlInfo(flightsql.SqlInfoFlightSqlServerName, "test"); err != nil {
+		t.Fatal(err)
+	}
+	server := flight.NewServerWithMiddleware(nil)
+	server.RegisterFlightService(flightsql.NewFlightServer(srv))
+	if err := server.Init("localhost:0"); err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = server.Serve() }()
+	t.Cleanup(server.Shutdown)
+
+	settings, err := json.Marshal(config{Addr: server.Addr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	instance, err := NewDatasource(context.Background(), backend.DataSourceInstanceSettings{UID: t.Name(), JSONData: settings})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds := instance.(*DataSource)
+	t.Cleanup(ds.Dispose)
+
+	checked := memory.NewCheckedAllocator(memory.NewGoAllocator())
+	ds.alloc.mem = checked
+	return ds, checked
+}
+
+// testQuery returns a data query for the JSON encoding of q over the first
+// hour of 2024.
+func testQuery(t testing.TB, refID string, q map[string]any) backend.DataQuery {
+	t.Helper()
+	q["refId"] = refID
+	b, err := json.Marshal(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	return backend.DataQuery{
+		RefID:     refID,
+		JSON:      b,
+		Interval:  time.Second,
+		TimeRange: backend.TimeRange{From: from, To: from.Add(time.Hour)},
+	}
+}
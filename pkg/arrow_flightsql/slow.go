@@ -0,0 +1,45 @@
+package arrow_flightsql
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// reportSlowStatement logs a statement that took longer than the slow query
+// threshold, with the panel it was executed for and its timings, and attaches
+// a warning notice to its frame.
+func (d *DataSource) reportSlowStatement(ctx context.Context, frame *data.Frame, sql string, stats *queryStats) {
+	elapsed := time.Since(stats.start)
+	if d.slowQueryThreshold <= 0 || elapsed <= d.slowQueryThreshold {
+		return
+	}
+
+	// The statement is redacted like the audit log, so that turning on literal
+	// redaction keeps the literals out of every log line.
+	if d.audit != nil && d.audit.redact {
+		sql = redactLiterals(sql)
+	}
+	args := append(d.requestLogArgs(ctx),
+		"statement", sql,
+		"threshold", d.slowQueryThreshold.String(),
+		"duration", elapsed.String(),
+		"flightInfoDuration", stats.flightInfoDuration.String(),
+		"firstBatchDuration", stats.firstBatchDuration.String(),
+		"batches", stats.batches,
+		"rows", stats.rows,
+		"bytes", stats.bytes,
+		"retries", stats.retries,
+	)
+	log.DefaultLogger.Warn("Slow query", args...)
+
+	frame.AppendNotices(data.Notice{
+		Severity: data.NoticeSeverityWarning,
+		Text: fmt.Sprintf("Slow query: took %s, above the %s threshold (%s to FlightInfo, %s to first batch, %d rows)",
+			elapsed.Round(time.Millisecond), d.slowQueryThreshold, stats.flightInfoDuration.Round(time.Millisecond),
+			stats.firstBatchDuration.Round(time.Millisecond), stats.rows),
+	})
+}
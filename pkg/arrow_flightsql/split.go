@@ -0,0 +1,234 @@
+package arrow_flightsql
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/gtime"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/grafana-plugin-sdk-go/data/sqlutil"
+	"google.golang.org/grpc/metadata"
+)
+
+// maxTimeRangeChunks bounds the number of chunks a single query is split into.
+const maxTimeRangeChunks = 1000
+
+// timeFilterMacros are the macros restricting a query to the half-open time
+// range [from, to), so that adjacent chunks do not share rows.
+var timeFilterMacros = []string{
+	"$__timeFilter",
+	"$__unixEpochFilter",
+	"$__unixEpochMsFilter",
+	"$__unixEpochNanoFilter",
+}
+
+// timeBoundMacros expand to the bounds of the time range. They are used with
+// inclusive comparisons such as BETWEEN, which return the rows on a chunk
+// boundary twice, so split queries may not use them.
+var timeBoundMacros = []string{
+	"$__timeFrom",
+	"$__timeTo",
+	"$__timeRange",
+}
+
+// containsMacro reports whether sql contains any of the macros.
+func containsMacro(sql string, macros []string) bool {
+	for _, m := range macros {
+		if strings.Contains(sql, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// timeRangeChunks splits the time range of a query into chunks of the
+// requested size and returns the query interpolated for each chunk. Each chunk
+// ends where the next one starts, on a multiple of the query interval since
+// the epoch: the half-open time filter macros return a row on a boundary in
+// exactly one chunk, and a $__dateBin bucket is never split across chunks.
+func timeRangeChunks(q queryRequest, query *sqlutil.Query) ([]string, error) {
+	size, err := gtime.ParseDuration(q.SplitDuration)
+	if err != nil {
+		return nil, fmt.Errorf("decodeQueryRequest SplitDuration -> %w", err)
+	}
+	if size <= 0 {
+		return nil, fmt.Errorf("split duration must be positive, got %q", q.SplitDuration)
+	}
+	// Without a time filter every chunk would return the whole result.
+	if !containsMacro(q.Text, timeFilterMacros) {
+		return nil, fmt.Errorf("split duration requires the query to filter on the time range with $__timeFilter or a $__unixEpochFilter macro")
+	}
+	if containsMacro(q.Text, timeBoundMacros) {
+		return nil, fmt.Errorf("split duration does not support $__timeFrom, $__timeTo and $__timeRange, which may return rows on chunk boundaries twice; use $__timeFilter instead")
+	}
+	from, to := query.TimeRange.From, query.TimeRange.To
+	if n := to.Sub(from) / size; n >= maxTimeRangeChunks {
+		return nil, fmt.Errorf("split duration %q would split the time range into more than %d chunks", q.SplitDuration, maxTimeRangeChunks)
+	}
+	// Chunks are at least one interval long, so every chunk ends on a new
+	// interval boundary.
+	if size < query.Interval {
+		size = query.Interval
+	}
+
+	var chunks []string
+	for start := from; start.Before(to); {
+		end := alignToInterval(start.Add(size), query.Interval)
+		if end.After(to) {
+			end = to
+		}
+
+		chunk := *query
+		chunk.RawSQL = q.Text
+		chunk.TimeRange = backend.TimeRange{From: start, To: end}
+		statements, err := interpolateStatements(q, &chunk)
+		if err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, statements[0])
+		start = end
+	}
+	return chunks, nil
+}
+
+// alignToInterval returns t rounded down to a multiple of interval since the
+// Unix epoch, the origin of the buckets of $__dateBin.
+func alignToInterval(t time.Time, interval time.Duration) time.Time {
+	if interval <= 0 {
+		return t
+	}
+	r := t.UnixNano() % int64(interval)
+	if r < 0 {
+		r += int64(interval)
+	}
+	return t.Add(-time.Duration(r))
+}
+
+// queryChunks executes the chunks of a split query concurrently and formats
+// their concatenated results as a single result.
+func (d *DataSource) queryChunks(ctx context.Context, query queryModel) backend.DataResponse {
+	frames := make([]*data.Frame, len(query.Chunks))
+	headers := make([]metadata.MD, len(query.Chunks))
+	chunkStats := make([]*queryStats, len(query.Chunks))
+	errs := make([]error, len(query.Chunks))
+
+	stats := newQueryStats()
+	stats.totalRecords, stats.totalBytes = 0, 0
+
+	var wg sync.WaitGroup
+	for i, sql := range query.Chunks {
+		wg.Add(1)
+		go func(i int, sql string) {
+			defer wg.Done()
+			defer func() {
+				if r := recover(); r != nil {
+					errs[i] = fmt.Errorf("panic: %s", r)
+				}
+			}()
+			chunkStats[i] = newQueryStats()
+			frames[i], headers[i], errs[i] = d.fetchFrame(ctx, sql, chunkStats[i])
+		}(i, sql)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return errorResponse(fmt.Errorf("chunk %d: %w", i+1, err), backend.StatusInternal)
+		}
+		stats.merge(chunkStats[i])
+	}
+
+	// Chunks cover consecutive time ranges, so once each chunk is sorted the
+	// concatenation is usually sorted too and the final sort does not copy.
+	if query.Format == sqlutil.FormatOptionTimeSeries {
+		for i := range frames {
+			frames[i] = sortFrameByTime(frames[i])
+		}
+	}
+	frame, truncated := concatFrames(frames, rowLimit)
+	if truncated && !stats.rowLimitReached {
+		addRowLimitNotice(frame)
+	}
+	stats.rowLimitReached = stats.rowLimitReached || truncated
+	if query.Format == sqlutil.FormatOptionTimeSeries {
+		frame = sortFrameByTime(frame)
+	}
+	query.RawSQL = strings.Join(query.Chunks, ";\n")
+	return newQueryDataResponse(ctx, frame, query, headers[0], stats)
+}
+
+// concatFrames appends the rows of frames sharing a schema into the first
+// frame, keeping the notices of all frames. At most limit rows are kept, and
+// truncated reports whether rows were dropped. The fields of the first frame
+// are extended once, and the other frames are dropped from the slice as soon
+// as they are copied so that their memory can be reclaimed.
+func concatFrames(frames []*data.Frame, limit int) (out *data.Frame, truncated bool) {
+	out = frames[0]
+	rows := out.Rows()
+	total := rows
+	for _, frame := range frames[1:] {
+		total += frame.Rows()
+	}
+	if rows > limit {
+		truncateFrame(out, limit)
+		rows = limit
+	}
+	if total > limit {
+		total, truncated = limit, true
+	}
+	for _, field := range out.Fields {
+		field.Extend(total - rows)
+	}
+
+	for j, frame := range frames[1:] {
+		n := frame.Rows()
+		if n > total-rows {
+			n = total - rows
+		}
+		for i, field := range frame.Fields {
+			for row := 0; row < n; row++ {
+				out.Fields[i].Set(rows+row, field.At(row))
+			}
+		}
+		rows += n
+		if frame.Meta != nil {
+			out.AppendNotices(frame.Meta.Notices...)
+		}
+		frames[j+1] = nil
+	}
+	return out, truncated
+}
+
+// sortFrameByTime stably sorts the rows of a frame by its first time field.
+// Rows with a null time come first.
+func sortFrameByTime(frame *data.Frame) *data.Frame {
+	timeIdx := timeFieldIndex(frame)
+	if timeIdx == -1 {
+		return frame
+	}
+
+	timeField := frame.Fields[timeIdx]
+	times := make([]int64, timeField.Len())
+	for i := range times {
+		if v, ok := timeField.ConcreteAt(i); ok {
+			times[i] = v.(time.Time).UnixNano()
+		} else {
+			times[i] = -1 << 63
+		}
+	}
+	if sort.SliceIsSorted(times, func(i, j int) bool { return times[i] < times[j] }) {
+		return frame
+	}
+
+	rows := make([]int, len(times))
+	for i := range rows {
+		rows[i] = i
+	}
+	sort.SliceStable(rows, func(i, j int) bool { return times[rows[i]] < times[rows[j]] })
+	return selectRows(frame, rows)
+}
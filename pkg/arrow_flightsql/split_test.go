@@ -0,0 +1,106 @@
+package arrow_flightsql
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/grafana-plugin-sdk-go/data/sqlutil"
+)
+
+func TestTimeRangeChunks(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	query := &sqlutil.Query{TimeRange: backend.TimeRange{From: from, To: from.Add(3 * time.Hour)}}
+
+	chunks, err := timeRangeChunks(queryRequest{Text: "SELECT * FROM t WHERE $__timeFilter(ts)", SplitDuration: "1h"}, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) != 3 {
+		t.Fatalf("got %d chunks, want 3", len(chunks))
+	}
+	// The half-open filter of each chunk ends where the next one starts.
+	want := []string{
+		"SELECT * FROM t WHERE ts >= cast('2024-01-01T00:00:00Z' as timestamp) AND ts < cast('2024-01-01T01:00:00Z' as timestamp)",
+		"SELECT * FROM t WHERE ts >= cast('2024-01-01T01:00:00Z' as timestamp) AND ts < cast('2024-01-01T02:00:00Z' as timestamp)",
+		"SELECT * FROM t WHERE ts >= cast('2024-01-01T02:00:00Z' as timestamp) AND ts < cast('2024-01-01T03:00:00Z' as timestamp)",
+	}
+	for i, chunk := range chunks {
+		if chunk != want[i] {
+			t.Errorf("chunk %d: got %s, want %s", i, chunk, want[i])
+		}
+	}
+
+	for _, sql := range []string{
+		"SELECT * FROM t",
+		"SELECT * FROM t WHERE ts BETWEEN $__timeFrom AND $__timeTo",
+		"SELECT * FROM t WHERE $__timeRange(ts)",
+		"SELECT * FROM t WHERE $__timeFilter(ts) AND ts <= $__timeTo",
+	} {
+		if _, err := timeRangeChunks(queryRequest{Text: sql, SplitDuration: "1h"}, query); err == nil {
+			t.Errorf("got no error for %s", sql)
+		}
+	}
+}
+
+func TestTimeRangeChunksAlignedToInterval(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 10, 0, time.UTC)
+	to := time.Date(2024, 1, 1, 2, 30, 0, 0, time.UTC)
+	interval := 7 * time.Minute
+	query := &sqlutil.Query{TimeRange: backend.TimeRange{From: from, To: to}, Interval: interval}
+
+	chunks, err := timeRangeChunks(queryRequest{Text: "$__unixEpochNanoFilter(ts)", SplitDuration: "1h"}, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) != 3 {
+		t.Fatalf("got %d chunks, want 3: %q", len(chunks), chunks)
+	}
+	next := from.UnixNano()
+	for i, chunk := range chunks {
+		var start, end int64
+		if _, err := fmt.Sscanf(chunk, "ts >= %d AND ts < %d", &start, &end); err != nil {
+			t.Fatalf("chunk %d: %s: %v", i, chunk, err)
+		}
+		if start != next {
+			t.Errorf("chunk %d starts at %d, want %d", i, start, next)
+		}
+		if i < len(chunks)-1 && end%int64(interval) != 0 {
+			t.Errorf("chunk %d ends at %s, which is not a multiple of %s", i, time.Unix(0, end).UTC(), interval)
+		}
+		next = end
+	}
+	if next != to.UnixNano() {
+		t.Errorf("last chunk ends at %d, want %d", next, to.UnixNano())
+	}
+}
+
+func TestConcatFramesLimit(t *testing.T) {
+	frames := []*data.Frame{
+		data.NewFrame("", data.NewField("v", nil, []int64{1, 2, 3})),
+		data.NewFrame("", data.NewField("v", nil, []int64{4, 5, 6})),
+		data.NewFrame("", data.NewField("v", nil, []int64{7})),
+	}
+	frame, truncated := concatFrames(frames, 5)
+	if !truncated {
+		t.Error("got truncated false, want true")
+	}
+	if frame.Rows() != 5 {
+		t.Fatalf("got %d rows, want 5", frame.Rows())
+	}
+	for i := 0; i < 5; i++ {
+		if got := frame.Fields[0].At(i).(int64); got != int64(i+1) {
+			t.Errorf("row %d: got %d, want %d", i, got, i+1)
+		}
+	}
+
+	frames = []*data.Frame{
+		data.NewFrame("", data.NewField("v", nil, []int64{1})),
+		data.NewFrame("", data.NewField("v", nil, []int64{2})),
+	}
+	if frame, truncated = concatFrames(frames, 5); truncated || frame.Rows() != 2 {
+		t.Errorf("got %d rows, truncated %v, want 2 rows", frame.Rows(), truncated)
+	}
+}
@@ -0,0 +1,202 @@
+package arrow_flightsql
+
+import "strings"
+
+// sqlTokenKind classifies the tokens of SQL text.
+type sqlTokenKind int
+
+const (
+	tokenSpace sqlTokenKind = iota
+	tokenWord
+	tokenNumber
+	// tokenString is a quoted string literal, including E'...' strings.
+	tokenString
+	// tokenIdentifier is a double-quoted or backquoted identifier.
+	tokenIdentifier
+	tokenComment
+	tokenSemicolon
+	// tokenOther is any other single byte, such as an operator or a parenthesis.
+	tokenOther
+)
+
+// sqlToken is a token of SQL text; text is the source text of the token,
+// including its quotes or comment markers.
+type sqlToken struct {
+	kind sqlTokenKind
+	text string
+}
+
+// sqlLexer splits SQL text into tokens. SQL dialects disagree on some lexical
+// rules; the zero value follows standard SQL and the fields enable the
+// variations of other dialects. E'...' strings always use backslash escapes.
+type sqlLexer struct {
+	// backslashEscapes makes a backslash escape the next byte of quoted
+	// strings and double-quoted identifiers, as in MySQL.
+	backslashEscapes bool
+	// dollarQuotes reads $tag$...$tag$ as strings, as in PostgreSQL.
+	dollarQuotes bool
+	// dashCommentSpace only starts a -- comment when it is followed by
+	// whitespace, as in MySQL.
+	dashCommentSpace bool
+}
+
+// tokens returns the tokens of sql. Unterminated quotes and comments extend
+// to the end of the text.
+func (l sqlLexer) tokens(sql string) []sqlToken {
+	var tokens []sqlToken
+	for i := 0; i < len(sql); {
+		kind, end := l.next(sql, i)
+		tokens = append(tokens, sqlToken{kind: kind, text: sql[i:end]})
+		i = end
+	}
+	return tokens
+}
+
+// next returns the kind and the end of the token starting at i.
+func (l sqlLexer) next(sql string, i int) (sqlTokenKind, int) {
+	switch c := sql[i]; {
+	case isSpaceByte(c):
+		j := i + 1
+		for j < len(sql) && isSpaceByte(sql[j]) {
+			j++
+		}
+		return tokenSpace, j
+	case c == '\'':
+		return tokenString, quoteEnd(sql, i, l.backslashEscapes)
+	case c == '"':
+		return tokenIdentifier, quoteEnd(sql, i, l.backslashEscapes)
+	case c == '`':
+		return tokenIdentifier, quoteEnd(sql, i, false)
+	case c == '-' && strings.HasPrefix(sql[i:], "--") &&
+		(!l.dashCommentSpace || i+2 == len(sql) || isSpaceByte(sql[i+2])):
+		if end := strings.IndexByte(sql[i:], '\n'); end >= 0 {
+			return tokenComment, i + end
+		}
+		return tokenComment, len(sql)
+	case c == '/' && strings.HasPrefix(sql[i:], "/*"):
+		if end := strings.Index(sql[i+2:], "*/"); end >= 0 {
+			return tokenComment, i + 2 + end + 2
+		}
+		return tokenComment, len(sql)
+	case c == '$' && l.dollarQuotes:
+		if end, ok := dollarQuoteEnd(sql, i); ok {
+			return tokenString, end
+		}
+		return tokenOther, i + 1
+	case c == ';':
+		return tokenSemicolon, i + 1
+	case c >= '0' && c <= '9':
+		j := i + 1
+		for j < len(sql) && (isWordByte(sql[j]) || sql[j] == '.') {
+			j++
+		}
+		return tokenNumber, j
+	case isWordByte(c):
+		j := i + 1
+		for j < len(sql) && isWordByte(sql[j]) {
+			j++
+		}
+		if j == i+1 && (c == 'E' || c == 'e') && j < len(sql) && sql[j] == '\'' {
+			return tokenString, quoteEnd(sql, j, true)
+		}
+		return tokenWord, j
+	default:
+		return tokenOther, i + 1
+	}
+}
+
+// quoteEnd returns the end of the quoted section starting at i, after its
+// closing quote. Doubled quotes are escaped quotes, and so is any byte after a
+// backslash with backslash escapes.
+func quoteEnd(sql string, i int, backslashEscapes bool) int {
+	quote := sql[i]
+	for j := i + 1; j < len(sql); j++ {
+		switch {
+		case backslashEscapes && sql[j] == '\\':
+			j++
+		case sql[j] != quote:
+		case j+1 < len(sql) && sql[j+1] == quote:
+			j++
+		default:
+			return j + 1
+		}
+	}
+	return len(sql)
+}
+
+// dollarQuoteEnd returns the end of the dollar-quoted string starting at i, if
+// i starts a $tag$ delimiter.
+func dollarQuoteEnd(sql string, i int) (int, bool) {
+	j := i + 1
+	for j < len(sql) && isWordByte(sql[j]) {
+		j++
+	}
+	if j >= len(sql) || sql[j] != '$' || (j > i+1 && sql[i+1] >= '0' && sql[i+1] <= '9') {
+		return 0, false
+	}
+	delimiter := sql[i : j+1]
+	if end := strings.Index(sql[j+1:], delimiter); end >= 0 {
+		return j + 1 + end + len(delimiter), true
+	}
+	return len(sql), true
+}
+
+// statements splits SQL text into statements on semicolons. Statements that
+// are empty or contain only comments are dropped.
+func (l sqlLexer) statements(sql string) []string {
+	var statements []string
+	var b strings.Builder
+	hasCode := false
+	for _, tok := range l.tokens(sql) {
+		switch tok.kind {
+		case tokenSemicolon:
+			if hasCode {
+				statements = append(statements, strings.TrimSpace(b.String()))
+			}
+			b.Reset()
+			hasCode = false
+			continue
+		case tokenSpace, tokenComment:
+		default:
+			hasCode = true
+		}
+		b.WriteString(tok.text)
+	}
+	if hasCode {
+		statements = append(statements, strings.TrimSpace(b.String()))
+	}
+	return statements
+}
+
+// keywords returns the upper-cased bare words of a statement, skipping
+// literals, quoted identifiers and comments.
+func (l sqlLexer) keywords(stmt string) []string {
+	var words []string
+	for _, tok := range l.tokens(stmt) {
+		if tok.kind == tokenWord {
+			words = append(words, strings.ToUpper(tok.text))
+		}
+	}
+	return words
+}
+
+// splitStatements splits SQL text into statements on semicolons. Semicolons
+// inside quoted strings, quoted identifiers and comments do not end a
+// statement. Statements that are empty or contain only comments are dropped.
+func splitStatements(sql string) []string {
+	return sqlLexer{}.statements(sql)
+}
+
+// sqlKeywords returns the upper-cased bare words of a statement, skipping
+// literals, quoted identifiers and comments.
+func sqlKeywords(stmt string) []string {
+	return sqlLexer{}.keywords(stmt)
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+func isSpaceByte(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v'
+}
@@ -0,0 +1,45 @@
+package arrow_flightsql
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		want []string
+	}{
+		{name: "single", sql: "SELECT 1", want: []string{"SELECT 1"}},
+		{name: "trailing semicolon", sql: "SELECT 1;", want: []string{"SELECT 1"}},
+		{name: "trailing semicolons and space", sql: "SELECT 1; ;\n ; ", want: []string{"SELECT 1"}},
+		{name: "several", sql: "SELECT 1;\nSELECT 2", want: []string{"SELECT 1", "SELECT 2"}},
+		{name: "string", sql: "SELECT 'a;b'; SELECT 2", want: []string{"SELECT 'a;b'", "SELECT 2"}},
+		{name: "doubled quotes", sql: "SELECT 'it''s;'; SELECT 2", want: []string{"SELECT 'it''s;'", "SELECT 2"}},
+		{name: "quoted identifier", sql: `SELECT "a;""b" FROM t; SELECT 2`, want: []string{`SELECT "a;""b" FROM t`, "SELECT 2"}},
+		{name: "backquoted identifier", sql: "SELECT `a;b` FROM t; SELECT 2", want: []string{"SELECT `a;b` FROM t", "SELECT 2"}},
+		{name: "escape string", sql: `SELECT E'a\';b'; SELECT 2`, want: []string{`SELECT E'a\';b'`, "SELECT 2"}},
+		{name: "line comment", sql: "SELECT 1 -- one; two\n; SELECT 2", want: []string{"SELECT 1 -- one; two", "SELECT 2"}},
+		{name: "block comment", sql: "SELECT /* ; */ 1; SELECT 2", want: []string{"SELECT /* ; */ 1", "SELECT 2"}},
+		{name: "comment only statements", sql: "SELECT 1; -- done\n; /* nothing */", want: []string{"SELECT 1"}},
+		{name: "unterminated string", sql: "SELECT 'a; SELECT 2", want: []string{"SELECT 'a; SELECT 2"}},
+		{name: "empty", sql: " ;; ", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitStatements(tt.sql)
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") || len(got) != len(tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactLiterals(t *testing.T) {
+	got := redactLiterals(`SELECT a1, 'it''s', E'\'x', 1.5 FROM "t2" WHERE b = 42 -- 'c'`)
+	want := `SELECT a1, ?, ?, ? FROM "t2" WHERE b = ? -- 'c'`
+	if got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
@@ -0,0 +1,106 @@
+package arrow_flightsql
+
+import (
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// queryStats collects timings and volumes of a single statement execution.
+type queryStats struct {
+	start              time.Time
+	flightInfoDuration time.Duration
+	firstBatchDuration time.Duration
+	batches            int64
+	rows               int64
+	bytes              int64
+	rowLimitReached    bool
+	// retries counts the calls repeated after transient server errors.
+	retries int64
+	// totalRecords and totalBytes are reported by the server in the FlightInfo;
+	// negative values mean unknown.
+	totalRecords int64
+	totalBytes   int64
+}
+
+// newQueryStats starts collecting statistics for a statement execution.
+func newQueryStats() *queryStats {
+	return &queryStats{
+		start:        time.Now(),
+		totalRecords: -1,
+		totalBytes:   -1,
+	}
+}
+
+// recordBatch records a received record batch.
+func (s *queryStats) recordBatch(rows int64) {
+	if s.batches == 0 {
+		s.firstBatchDuration = time.Since(s.start)
+	}
+	s.batches++
+	s.rows += rows
+}
+
+// merge adds the statistics of a statement executed as part of the same query.
+func (s *queryStats) merge(o *queryStats) {
+	if s.batches == 0 || (o.batches > 0 && o.firstBatchDuration < s.firstBatchDuration) {
+		s.firstBatchDuration = o.firstBatchDuration
+	}
+	if o.flightInfoDuration > s.flightInfoDuration {
+		s.flightInfoDuration = o.flightInfoDuration
+	}
+	s.batches += o.batches
+	s.rows += o.rows
+	s.bytes += o.bytes
+	s.rowLimitReached = s.rowLimitReached || o.rowLimitReached
+	s.retries += o.retries
+	s.totalRecords = sumKnown(s.totalRecords, o.totalRecords)
+	s.totalBytes = sumKnown(s.totalBytes, o.totalBytes)
+}
+
+// sumKnown adds two server-reported totals; the result is unknown if either is.
+func sumKnown(a, b int64) int64 {
+	if a < 0 || b < 0 {
+		return -1
+	}
+	return a + b
+}
+
+// frameStats returns the statistics to display in the query inspector.
+func (s *queryStats) frameStats() []data.QueryStat {
+	stats := []data.QueryStat{
+		durationStat("Time to FlightInfo", s.flightInfoDuration),
+		durationStat("Time to first batch", s.firstBatchDuration),
+		durationStat("Total execution time", time.Since(s.start)),
+		countStat("Record batches", s.batches, ""),
+		countStat("Rows", s.rows, ""),
+		countStat("Bytes received", s.bytes, "bytes"),
+	}
+	if s.retries > 0 {
+		stats = append(stats, countStat("Retries", s.retries, ""))
+	}
+	if s.rowLimitReached && s.totalRecords >= 0 {
+		stats = append(stats, countStat("Rows dropped by row limit", s.totalRecords-s.rows, ""))
+	}
+	if s.totalRecords >= 0 {
+		stats = append(stats, countStat("FlightInfo total records", s.totalRecords, ""))
+	}
+	if s.totalBytes >= 0 {
+		stats = append(stats, countStat("FlightInfo total bytes", s.totalBytes, "bytes"))
+	}
+	return stats
+}
+
+func durationStat(name string, d time.Duration) data.QueryStat {
+	return data.QueryStat{
+		FieldConfig: data.FieldConfig{DisplayName: name, Unit: "ms"},
+		Value:       float64(d.Microseconds()) / 1000,
+	}
+}
+
+func countStat(name string, v int64, unit string) data.QueryStat {
+	return data.QueryStat{
+		FieldConfig: data.FieldConfig{DisplayName: name, Unit: unit},
+		Value:       float64(v),
+	}
+}
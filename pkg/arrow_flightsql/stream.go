@@ -0,0 +1,406 @@
+package arrow_flightsql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/gtime"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+const (
+	// streamPathPrefix is the prefix of the Grafana Live channel paths handled by the datasource.
+	streamPathPrefix = "stream/"
+	// defaultStreamInterval is the polling interval of streams that do not set one.
+	defaultStreamInterval = 5 * time.Second
+	// minStreamInterval bounds how often a stream may poll the server.
+	minStreamInterval = time.Second
+	// maxStreamSeenRows bounds the number of row hashes a channel remembers for deduplication.
+	maxStreamSeenRows = 10000
+	// streamBufferSize is the number of polled frames buffered per channel.
+	streamBufferSize = 16
+	// streamPollWindows is the number of intervals a stream in poll mode queries.
+	streamPollWindows = 10
+)
+
+// streamMode selects how a stream finds new rows.
+type streamMode string
+
+const (
+	// streamModeTail queries from the latest time seen so far up to now.
+	streamModeTail streamMode = "tail"
+	// streamModePoll reruns the query over the last streamPollWindows intervals
+	// and drops the rows that were already sent.
+	streamModePoll streamMode = "poll"
+)
+
+// streamRequest is the subscription data of a stream: a query request and its
+// streaming options.
+type streamRequest struct {
+	queryRequest
+	StreamInterval string `json:"streamInterval"`
+	StreamMode     string `json:"streamMode"`
+}
+
+// streamOptions is a decoded stream subscription.
+type streamOptions struct {
+	// query is the query request as sent by the panel.
+	query    json.RawMessage
+	interval time.Duration
+	mode     streamMode
+}
+
+// parseStreamOptions decodes the subscription data of a stream.
+func parseStreamOptions(raw json.RawMessage) (streamOptions, error) {
+	var r streamRequest
+	if err := json.Unmarshal(raw, &r); err != nil {
+		return streamOptions{}, fmt.Errorf("parseStreamOptions Unmarshal -> %w", err)
+	}
+	if r.Text == "" && r.Table == "" {
+		return streamOptions{}, fmt.Errorf("stream query is empty")
+	}
+	if r.SplitStatements || r.SplitDuration != "" || r.IncrementalCache {
+		return streamOptions{}, fmt.Errorf("streams cannot be combined with multiple statements, time range splitting or incremental caching")
+	}
+
+	opts := streamOptions{query: raw, interval: defaultStreamInterval, mode: streamModeTail}
+	if r.StreamInterval != "" {
+		interval, err := gtime.ParseDuration(r.StreamInterval)
+		if err != nil {
+			return streamOptions{}, fmt.Errorf("parseStreamOptions StreamInterval -> %w", err)
+		}
+		if interval < minStreamInterval {
+			interval = minStreamInterval
+		}
+		opts.interval = interval
+	}
+	switch r.StreamMode {
+	case "", string(streamModeTail):
+	case string(streamModePoll):
+		opts.mode = streamModePoll
+	default:
+		return streamOptions{}, fmt.Errorf("unknown stream mode %q", r.StreamMode)
+	}
+	return opts, nil
+}
+
+// SubscribeStream is called when a panel subscribes to a Grafana Live channel of the datasource.
+func (d *DataSource) SubscribeStream(ctx context.Context, req *backend.SubscribeStreamRequest) (*backend.SubscribeStreamResponse, error) {
+	if !strings.HasPrefix(req.Path, streamPathPrefix) {
+		return &backend.SubscribeStreamResponse{Status: backend.SubscribeStreamStatusNotFound}, nil
+	}
+	if _, err := parseStreamOptions(req.Data); err != nil {
+		logErrorf("Invalid stream subscription %s: %s", req.Path, err)
+		return &backend.SubscribeStreamResponse{Status: backend.SubscribeStreamStatusNotFound}, nil
+	}
+	return &backend.SubscribeStreamResponse{Status: backend.SubscribeStreamStatusOK}, nil
+}
+
+// PublishStream is called when a client publishes to a channel of the
+// datasource; streams are read-only.
+func (d *DataSource) PublishStream(ctx context.Context, req *backend.PublishStreamRequest) (*backend.PublishStreamResponse, error) {
+	return &backend.PublishStreamResponse{Status: backend.PublishStreamStatusPermissionDenied}, nil
+}
+
+// RunStream is called once per channel with subscribers. It receives the
+// frames of the poller shared by identical subscriptions and sends the rows
+// the channel has not seen yet.
+func (d *DataSource) RunStream(ctx context.Context, req *backend.RunStreamRequest, sender *backend.StreamSender) error {
+	opts, err := parseStreamOptions(req.Data)
+	if err != nil {
+		return err
+	}
+
+	frames, unsubscribe := d.streamPollers.subscribe(opts, d.pollStream)
+	defer unsubscribe()
+	activeStreams.WithLabelValues(d.uid).Inc()
+	defer activeStreams.WithLabelValues(d.uid).Dec()
+
+	dedup := newStreamDedup(opts.mode)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case polled := <-frames:
+			out := dedup.filter(polled.frame, polled.from)
+			if out.Rows() == 0 {
+				continue
+			}
+			if err := sender.SendFrame(out, data.IncludeAll); err != nil {
+				return fmt.Errorf("RunStream SendFrame -> %w", err)
+			}
+		}
+	}
+}
+
+// polledFrame is the result of a stream query over the time range starting at from.
+type polledFrame struct {
+	frame *data.Frame
+	from  time.Time
+}
+
+// pollStream executes the query of a stream on every tick of its interval and
+// passes the results to publish until ctx is done. In tail mode the time range
+// starts at the latest time seen so far; in poll mode it is the last
+// streamPollWindows intervals, but not before the stream started.
+func (d *DataSource) pollStream(ctx context.Context, opts streamOptions, publish func(polledFrame)) {
+	ticker := time.NewTicker(opts.interval)
+	defer ticker.Stop()
+
+	start := time.Now().Add(-opts.interval)
+	from := start
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		now := time.Now()
+		if opts.mode == streamModePoll {
+			if windowStart := now.Add(-streamPollWindows * opts.interval); windowStart.After(start) {
+				from = windowStart
+			}
+		}
+		frame, err := d.pollStreamOnce(ctx, opts, backend.TimeRange{From: from, To: now})
+		if err != nil {
+			logErrorf("Stream poll failed: %s", err)
+			continue
+		}
+		publish(polledFrame{frame: frame, from: from})
+		if opts.mode == streamModeTail {
+			if latest, ok := latestTime(frame); ok && latest.After(from) {
+				from = latest
+			}
+		}
+	}
+}
+
+// pollStreamOnce executes the query of a stream over a time range and returns
+// its result sorted by time. A panic is returned as an error so that the
+// stream keeps polling.
+func (d *DataSource) pollStreamOnce(ctx context.Context, opts streamOptions, tr backend.TimeRange) (frame *data.Frame, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			logErrorf("Panic: %s %s", r, string(debug.Stack()))
+			frame, err = nil, fmt.Errorf("panic: %s", r)
+		}
+	}()
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second+opts.interval)
+	defer cancel()
+
+	if err := d.authenticate(ctx); err != nil {
+		return nil, err
+	}
+	query, err := d.decodeQueryRequest(ctx, backend.DataQuery{JSON: opts.query, TimeRange: tr})
+	if err != nil {
+		return nil, err
+	}
+	frame, _, err = d.fetchFrame(d.outgoingContext(ctx, query.Metadata), query.RawSQL, newQueryStats())
+	if err != nil {
+		return nil, err
+	}
+	frame.RefID = query.RefID
+	return sortFrameByTime(frame), nil
+}
+
+// latestTime returns the latest time of the first time field of a frame.
+func latestTime(frame *data.Frame) (time.Time, bool) {
+	timeIdx := timeFieldIndex(frame)
+	if timeIdx == -1 {
+		return time.Time{}, false
+	}
+	var latest time.Time
+	found := false
+	for i := 0; i < frame.Rows(); i++ {
+		if v, ok := frame.Fields[timeIdx].ConcreteAt(i); ok && (!found || v.(time.Time).After(latest)) {
+			latest, found = v.(time.Time), true
+		}
+	}
+	return latest, found
+}
+
+// streamPoller polls the query of identical subscriptions and fans its
+// results out to their channels.
+type streamPoller struct {
+	subscribers map[chan polledFrame]struct{}
+	cancel      context.CancelFunc
+}
+
+// streamPollers keeps one poller per distinct stream subscription.
+type streamPollers struct {
+	mu      sync.Mutex
+	pollers map[string]*streamPoller
+}
+
+func newStreamPollers() *streamPollers {
+	return &streamPollers{pollers: make(map[string]*streamPoller)}
+}
+
+// subscribe returns a channel receiving the frames polled for a subscription,
+// starting a poller if none runs for it yet. The poller stops once its last
+// subscriber unsubscribes.
+func (p *streamPollers) subscribe(opts streamOptions, poll func(context.Context, streamOptions, func(polledFrame))) (<-chan polledFrame, func()) {
+	key := fmt.Sprintf("%s/%s/%s", opts.mode, opts.interval, opts.query)
+	frames := make(chan polledFrame, streamBufferSize)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	poller, ok := p.pollers[key]
+	if !ok {
+		ctx, cancel := context.WithCancel(context.Background())
+		poller = &streamPoller{subscribers: make(map[chan polledFrame]struct{}), cancel: cancel}
+		p.pollers[key] = poller
+		go poll(ctx, opts, func(polled polledFrame) { p.publish(poller, polled) })
+	}
+	poller.subscribers[frames] = struct{}{}
+
+	unsubscribe := func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		delete(poller.subscribers, frames)
+		if len(poller.subscribers) == 0 {
+			poller.cancel()
+			if p.pollers[key] == poller {
+				delete(p.pollers, key)
+			}
+		}
+	}
+	return frames, unsubscribe
+}
+
+// publish sends a frame to every subscriber of a poller. Subscribers that fall
+// behind by more than streamBufferSize frames miss the frame.
+func (p *streamPollers) publish(poller *streamPoller, polled polledFrame) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for frames := range poller.subscribers {
+		select {
+		case frames <- polled:
+		default:
+			logErrorf("Stream subscriber is falling behind, dropping %d rows", polled.frame.Rows())
+		}
+	}
+}
+
+// close stops all pollers.
+func (p *streamPollers) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for key, poller := range p.pollers {
+		poller.cancel()
+		delete(p.pollers, key)
+	}
+}
+
+// streamDedup tracks the rows a channel has already sent.
+type streamDedup struct {
+	mode streamMode
+	// watermark is the latest time sent in tail mode and atWatermark the
+	// hashes of the rows sent at that time.
+	watermark   time.Time
+	atWatermark map[uint64]struct{}
+	// inWindow holds the hashes of the rows sent in poll mode with their
+	// times. Rows before the start of the polled window are forgotten, as
+	// later polls cannot return them.
+	inWindow map[uint64]time.Time
+	// seen holds the hashes of the rows without time, oldest first in order.
+	seen  map[uint64]struct{}
+	order []uint64
+}
+
+func newStreamDedup(mode streamMode) *streamDedup {
+	return &streamDedup{
+		mode:        mode,
+		atWatermark: make(map[uint64]struct{}),
+		inWindow:    make(map[uint64]time.Time),
+		seen:        make(map[uint64]struct{}),
+	}
+}
+
+// filter returns the rows of a frame sorted by time, polled over a time range
+// starting at from, that were not sent before.
+func (s *streamDedup) filter(frame *data.Frame, from time.Time) *data.Frame {
+	for h, t := range s.inWindow {
+		if t.Before(from) {
+			delete(s.inWindow, h)
+		}
+	}
+
+	timeIdx := timeFieldIndex(frame)
+	var rows []int
+	for i := 0; i < frame.Rows(); i++ {
+		h := rowHash(frame, i)
+		if timeIdx == -1 {
+			if s.markSeen(h) {
+				rows = append(rows, i)
+			}
+			continue
+		}
+
+		v, ok := frame.Fields[timeIdx].ConcreteAt(i)
+		if !ok {
+			if s.mode == streamModePoll && s.markSeen(h) {
+				rows = append(rows, i)
+			}
+			continue
+		}
+		t := v.(time.Time)
+		if s.mode == streamModePoll {
+			if _, dup := s.inWindow[h]; !dup {
+				s.inWindow[h] = t
+				rows = append(rows, i)
+			}
+			continue
+		}
+		switch {
+		case t.Before(s.watermark):
+			continue
+		case t.After(s.watermark):
+			s.watermark = t
+			s.atWatermark = make(map[uint64]struct{})
+		default:
+			if _, dup := s.atWatermark[h]; dup {
+				continue
+			}
+		}
+		s.atWatermark[h] = struct{}{}
+		rows = append(rows, i)
+	}
+	return selectRows(frame, rows)
+}
+
+// markSeen records the hash of a row without time and reports whether it was
+// new, forgetting the oldest hashes beyond maxStreamSeenRows.
+func (s *streamDedup) markSeen(h uint64) bool {
+	if _, ok := s.seen[h]; ok {
+		return false
+	}
+	s.seen[h] = struct{}{}
+	s.order = append(s.order, h)
+	if len(s.order) > maxStreamSeenRows {
+		delete(s.seen, s.order[0])
+		s.order = s.order[1:]
+	}
+	return true
+}
+
+// rowHash returns a hash of the values of a row.
+func rowHash(frame *data.Frame, row int) uint64 {
+	h := fnv.New64a()
+	for _, field := range frame.Fields {
+		if v, ok := field.ConcreteAt(row); ok {
+			fmt.Fprintf(h, "%v\x00", v)
+		} else {
+			h.Write([]byte{0xff, 0})
+		}
+	}
+	return h.Sum64()
+}
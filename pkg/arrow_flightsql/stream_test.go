@@ -0,0 +1,44 @@
+package arrow_flightsql
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+func streamFrame(times []time.Time, values []int64) *data.Frame {
+	return data.NewFrame("", data.NewField("time", nil, times), data.NewField("v", nil, values))
+}
+
+func TestStreamDedupPoll(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(s int) time.Time { return t0.Add(time.Duration(s) * time.Second) }
+	dedup := newStreamDedup(streamModePoll)
+
+	out := dedup.filter(streamFrame([]time.Time{at(1), at(2)}, []int64{1, 2}), at(0))
+	if out.Rows() != 2 {
+		t.Fatalf("first poll: got %d rows, want 2", out.Rows())
+	}
+	out = dedup.filter(streamFrame([]time.Time{at(1), at(2), at(2), at(3)}, []int64{1, 2, 5, 3}), at(0))
+	if out.Rows() != 2 {
+		t.Fatalf("second poll: got %d rows, want 2", out.Rows())
+	}
+
+	// Rows before the window start are forgotten.
+	dedup.filter(streamFrame(nil, nil), at(3))
+	if len(dedup.inWindow) != 1 {
+		t.Errorf("got %d remembered rows, want 1", len(dedup.inWindow))
+	}
+}
+
+func TestStreamDedupTail(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	dedup := newStreamDedup(streamModeTail)
+
+	dedup.filter(streamFrame([]time.Time{t0, t0.Add(time.Second)}, []int64{1, 2}), t0)
+	out := dedup.filter(streamFrame([]time.Time{t0.Add(time.Second), t0.Add(time.Second), t0.Add(2 * time.Second)}, []int64{2, 3, 4}), t0.Add(time.Second))
+	if out.Rows() != 2 {
+		t.Errorf("got %d rows, want 2", out.Rows())
+	}
+}
@@ -0,0 +1,72 @@
+package arrow_flightsql
+
+import (
+	"context"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/tracing"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// traceContext propagates spans to the server as W3C trace context headers.
+var traceContext = propagation.TraceContext{}
+
+// startSpan starts a span with the SDK's tracer.
+func startSpan(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return tracing.DefaultTracer().Start(ctx, name, opts...)
+}
+
+// endSpan records err on a span, if any, and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		tracing.Error(span, err)
+	}
+	span.End()
+}
+
+// metadataCarrier adapts outgoing gRPC metadata to a propagation.TextMapCarrier.
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	if v := metadata.MD(c).Get(key); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// withTraceContext adds the trace context of the current span to the outgoing metadata of ctx.
+func withTraceContext(ctx context.Context) context.Context {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return ctx
+	}
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if !ok {
+		md = metadata.MD{}
+	}
+	traceContext.Inject(ctx, metadataCarrier(md))
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+// traceUnaryInterceptor propagates the trace context on unary calls.
+func traceUnaryInterceptor(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	return invoker(withTraceContext(ctx), method, req, reply, cc, opts...)
+}
+
+// traceStreamInterceptor propagates the trace context on streaming calls.
+func traceStreamInterceptor(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	return streamer(withTraceContext(ctx), desc, cc, method, opts...)
+}
@@ -26,3 +26,7 @@ func recoverer(next http.Handler) http.Handler {
 func logErrorf(format string, v ...any) {
 	log.DefaultLogger.Error(fmt.Sprintf(format, v...))
 }
+
+func logWarnf(format string, v ...any) {
+	log.DefaultLogger.Warn(fmt.Sprintf(format, v...))
+}
@@ -0,0 +1,42 @@
+import React from 'react'
+import {InlineField, InlineFieldRow, Input} from '@grafana/ui'
+import {QueryEditorProps} from '@grafana/data'
+import {FlightSQLDataSource} from '../datasource'
+import {AnnotationMapping, FlightSQLDataSourceOptions, SQLQuery} from '../types'
+import {QueryEditor} from './QueryEditor'
+
+// ANNOTATION_FIELDS are the annotation event fields whose source column can be remapped.
+const ANNOTATION_FIELDS: Array<{key: keyof AnnotationMapping; label: string; tooltip: string}> = [
+  {key: 'time', label: 'Time', tooltip: 'Timestamp column holding the start of the event'},
+  {key: 'timeEnd', label: 'Time End', tooltip: 'Timestamp column holding the end of a region event'},
+  {key: 'title', label: 'Title', tooltip: 'Column holding the title of the event'},
+  {key: 'text', label: 'Text', tooltip: 'Column holding the description of the event'},
+  {key: 'tags', label: 'Tags', tooltip: 'Column holding a comma separated string or an array of tags'},
+]
+
+export function AnnotationQueryEditor(props: QueryEditorProps<FlightSQLDataSource, SQLQuery, FlightSQLDataSourceOptions>) {
+  const {query, onChange} = props
+  const mapping = query.annotationMapping || {}
+
+  const setColumn = (key: keyof AnnotationMapping, column: string) => {
+    onChange({...query, annotationMapping: {...mapping, [key]: column.trim() || undefined}})
+  }
+
+  return (
+    <>
+      <QueryEditor {...props} />
+      <InlineFieldRow style={{marginTop: '5px'}}>
+        {ANNOTATION_FIELDS.map(({key, label, tooltip}) => (
+          <InlineField key={key} label={label} tooltip={tooltip}>
+            <Input
+              width={15}
+              placeholder={key}
+              defaultValue={mapping[key]}
+              onBlur={(e) => setColumn(key, e.currentTarget.value)}
+            />
+          </InlineField>
+        ))}
+      </InlineFieldRow>
+    </>
+  )
+}
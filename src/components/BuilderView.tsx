@@ -28,6 +28,7 @@ export function BuilderView({query, datasource, onChange, fromRawSql}: any) {
   const [where, setWhere] = useState('')
   const [orderBy, setOrderBy] = useState('')
   const [limit, setLimit] = useState('')
+  const [timeColumn, setTimeColumn] = useState('')
   const [columns, setColumns] = useState()
   const [table, setTable] = useState<SelectableValue<string>>()
   const [column, setColumn] = useState<SelectableValue<string>>()
@@ -43,6 +44,7 @@ export function BuilderView({query, datasource, onChange, fromRawSql}: any) {
         index: '',
         label: t.name,
         value: t.name,
+        type: t.type,
       }))
       setColumns(columns)
     })()
@@ -79,21 +81,24 @@ export function BuilderView({query, datasource, onChange, fromRawSql}: any) {
       const selectColumns = formatColumns(columnValues)
       const casedTable = checkCasing(table.value || '')
       const prefixDBSchema = prefixDB(casedTable, table?.dbSchema)
-      const whereExps = formatWheres(whereValues)
+      const timeFilter = timeColumn && `$__timeFilter(${timeColumn})`
+      const whereExps = [timeFilter, formatWheres(whereValues)].filter(Boolean).join(' and ')
       const queryText = buildQueryString(selectColumns, prefixDBSchema, whereExps, orderBy, groupBy, limit)
       onChange({
         ...query,
         queryText: queryText,
         table: casedTable,
+        dbSchema: table?.dbSchema,
         columns: columnValues,
         wheres: whereValues,
         orderBy: orderBy,
         groupBy: groupBy,
         limit: limit,
+        timeColumn: timeColumn || undefined,
       })
     }
     // eslint-disable-next-line react-hooks/exhaustive-deps
-  }, [table, columnValues, groupBy, whereValues, orderBy, limit, column])
+  }, [table, columnValues, groupBy, whereValues, orderBy, limit, column, timeColumn])
 
   useEffect(() => {
     if (column) {
@@ -118,10 +123,12 @@ export function BuilderView({query, datasource, onChange, fromRawSql}: any) {
   useEffect(() => {
     if (!fromRawSql && tables) {
       const unquotedTable = removeQuotes(query?.table)
-      const tableExists = tables?.find((t: any) => t.label === unquotedTable)
+      const tableExists = tables?.find(
+        (t: any) => t.label === unquotedTable && (!query.dbSchema || t.dbSchema === query.dbSchema)
+      )
       if (tableExists) {
         if (query.table) {
-          setTable({value: unquotedTable, label: unquotedTable})
+          setTable({value: unquotedTable, label: unquotedTable, dbSchema: tableExists.dbSchema})
         }
         if (query.columns) {
           setColumnValues(query.columns)
@@ -138,6 +145,9 @@ export function BuilderView({query, datasource, onChange, fromRawSql}: any) {
         if (query.limit) {
           setLimit(query.limit)
         }
+        if (query.timeColumn) {
+          setTimeColumn(query.timeColumn)
+        }
       }
       if (!tableExists) {
         query.queryText = ''
@@ -198,6 +208,18 @@ export function BuilderView({query, datasource, onChange, fromRawSql}: any) {
           ))}
         </SegmentSection>
       </div>
+      <div className={selectClass}>
+        <SegmentSection label="TIME FILTER" fill={true}>
+          <Select
+            options={(columns || []).filter((c: any) => c.type === 'time')}
+            onChange={(v) => setTimeColumn(v?.value || '')}
+            value={timeColumn || null}
+            isClearable={true}
+            width={20}
+            placeholder="(optional)"
+          />
+        </SegmentSection>
+      </div>
       <div className={selectClass}>
         <SegmentSection label="WHERE" fill={true}>
           {whereValues.map((_, index) => (
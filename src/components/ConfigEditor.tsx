@@ -1,5 +1,5 @@
 import React, {useEffect, useState} from 'react'
-import {InlineSwitch, FieldSet, InlineField, SecretInput, Input, InlineFieldRow, InlineLabel, TextArea} from '@grafana/ui'
+import {InlineSwitch, FieldSet, InlineField, SecretInput, Input, InlineFieldRow, InlineLabel, TextArea, TagsInput} from '@grafana/ui'
 import {DataSourcePluginOptionsEditorProps, SelectableValue} from '@grafana/data'
 import {FlightSQLDataSourceOptions, SecureJsonData} from '../types'
 import {
@@ -98,6 +98,97 @@ export function ConfigEditor(props: DataSourcePluginOptionsEditorProps<FlightSQL
         }
         
       </FieldSet>
+      <FieldSet label="Query Restrictions" width={400}>
+        <InlineField
+          labelWidth={20}
+          label="Read Only"
+          tooltip="Reject statements other than SELECT, WITH, SHOW, EXPLAIN and DESCRIBE"
+        >
+          <InlineSwitch
+            value={jsonData.readOnly || false}
+            onChange={() => onOptionsChange({...options, jsonData: {...jsonData, readOnly: !jsonData.readOnly}})}
+          />
+        </InlineField>
+      </FieldSet>
+      <FieldSet label="Audit" width={400}>
+        <InlineField labelWidth={20} label="Audit Log" tooltip="Log every executed statement with its user and panel">
+          <InlineSwitch
+            value={jsonData.auditLog || false}
+            onChange={() => onOptionsChange({...options, jsonData: {...jsonData, auditLog: !jsonData.auditLog}})}
+          />
+        </InlineField>
+        {jsonData.auditLog ? (
+          <>
+            <InlineField
+              labelWidth={20}
+              label="Sample Rate"
+              tooltip="Fraction of successful statements logged, between 0 and 1. Failed statements are always logged"
+            >
+              <Input
+                width={40}
+                name="auditSampleRate"
+                type="number"
+                value={jsonData.auditSampleRate ?? ''}
+                placeholder="1"
+                onChange={(e) =>
+                  onOptionsChange({
+                    ...options,
+                    jsonData: {...jsonData, auditSampleRate: parseFloat(e.currentTarget.value) || undefined},
+                  })
+                }
+              ></Input>
+            </InlineField>
+            <InlineField labelWidth={20} label="Redact Literals" tooltip="Replace string and number literals with ?">
+              <InlineSwitch
+                value={jsonData.auditRedactLiterals || false}
+                onChange={() =>
+                  onOptionsChange({
+                    ...options,
+                    jsonData: {...jsonData, auditRedactLiterals: !jsonData.auditRedactLiterals},
+                  })
+                }
+              />
+            </InlineField>
+          </>
+        ) : null}
+      </FieldSet>
+      <FieldSet label="Ad-hoc Filters" width={400}>
+        <InlineField labelWidth={20} label="Table" tooltip="Table whose columns and values are offered as ad-hoc filters">
+          <Input
+            width={40}
+            name="adhocFiltersTable"
+            type="text"
+            value={jsonData.adhocFiltersTable || ''}
+            placeholder="table"
+            onChange={(e) =>
+              onOptionsChange({...options, jsonData: {...jsonData, adhocFiltersTable: e.currentTarget.value}})
+            }
+          ></Input>
+        </InlineField>
+      </FieldSet>
+      <FieldSet label="Query Overrides" width={400}>
+        <InlineField
+          labelWidth={20}
+          label="Overridable Keys"
+          tooltip="Metadata keys that queries may override, e.g. database. Press enter to add a key"
+        >
+          <TagsInput
+            width={40}
+            tags={jsonData.overridableHeaders || []}
+            placeholder="database"
+            addOnBlur
+            onChange={(tags) =>
+              onOptionsChange({
+                ...options,
+                jsonData: {
+                  ...jsonData,
+                  overridableHeaders: tags.map((k) => k.trim()).filter(Boolean),
+                },
+              })
+            }
+          />
+        </InlineField>
+      </FieldSet>
       <FieldSet label="MetaData" width={400}>
         {metaDataArr?.map((_: any, i: any) => (
           <InlineFieldRow key={i} style={{flexFlow: 'row'}}>
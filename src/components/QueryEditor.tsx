@@ -1,9 +1,18 @@
 import React, {useState, useMemo, useCallback, useEffect} from 'react'
-import {Button, Modal, SegmentSection, Select, InlineFieldRow, SegmentInput, Drawer} from '@grafana/ui'
+import {Button, Modal, SegmentSection, Select, InlineFieldRow, SegmentInput, Drawer, InlineSwitch, Input} from '@grafana/ui'
 import {QueryEditorProps, SelectableValue} from '@grafana/data'
 import {MacroType} from '@grafana/experimental'
 import {FlightSQLDataSource} from '../datasource'
-import {FlightSQLDataSourceOptions, SQLQuery, sqlLanguageDefinition, QUERY_FORMAT_OPTIONS} from '../types'
+import {
+  FlightSQLDataSourceOptions,
+  SQLQuery,
+  sqlLanguageDefinition,
+  QUERY_FORMAT_OPTIONS,
+  QueryFormat,
+  TIME_SERIES_OUTPUT_OPTIONS,
+  DOWNSAMPLE_OPTIONS,
+  STREAM_MODE_OPTIONS,
+} from '../types'
 import {getSqlCompletionProvider, checkCasing} from './utils'
 
 import {QueryEditorRaw} from './QueryEditorRaw'
@@ -176,6 +185,58 @@ export function QueryEditor(props: QueryEditorProps<FlightSQLDataSource, SQLQuer
               placeholder="Table"
             />
           </SegmentSection>
+          {query.format === QueryFormat.Timeseries && (
+            <SegmentSection label="Series As" fill={false}>
+              <Select
+                options={TIME_SERIES_OUTPUT_OPTIONS}
+                onChange={(v) => onChange({...query, timeSeriesOutput: v.value})}
+                value={query.timeSeriesOutput}
+                width={15}
+                placeholder="Wide"
+              />
+            </SegmentSection>
+          )}
+          {query.format === QueryFormat.Timeseries && (
+            <SegmentSection label="Alias" fill={false}>
+              <Input
+                width={25}
+                placeholder="{{__field_name}}"
+                defaultValue={query.alias}
+                onBlur={(e) => onChange({...query, alias: e.currentTarget.value})}
+              />
+            </SegmentSection>
+          )}
+          {query.format === QueryFormat.Timeseries && (
+            <SegmentSection label="Downsample" fill={false}>
+              <Select
+                options={DOWNSAMPLE_OPTIONS}
+                onChange={(v) => onChange({...query, downsample: v.value})}
+                value={query.downsample || ''}
+                width={15}
+              />
+            </SegmentSection>
+          )}
+          {rawEditor && (
+            <SegmentSection label="Split Statements" fill={false}>
+              <InlineSwitch
+                value={query.splitStatements || false}
+                onChange={() => onChange({...query, splitStatements: !query.splitStatements})}
+              />
+            </SegmentSection>
+          )}
+          <SegmentSection label="Stream" fill={false}>
+            <InlineSwitch value={query.stream || false} onChange={() => onChange({...query, stream: !query.stream})} />
+          </SegmentSection>
+          {query.stream && (
+            <SegmentSection label="Stream Mode" fill={false}>
+              <Select
+                options={STREAM_MODE_OPTIONS}
+                onChange={(v) => onChange({...query, streamMode: v.value})}
+                value={query.streamMode || 'tail'}
+                width={15}
+              />
+            </SegmentSection>
+          )}
           <Button style={{marginLeft: '5px'}} fill="outline" size="md" onClick={() => showWarningModal(!warningModal)}>
             {rawEditor ? 'Builder View' : 'Edit SQL'}
           </Button>
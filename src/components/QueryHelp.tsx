@@ -25,6 +25,17 @@ export const QueryHelp = () => (
         </Card.Description>
       </Card>
 
+      <Card>
+        <Card.Heading>$__interval_ms, $__interval_ns</Card.Heading>
+        <Card.Description>
+        Get the time interval from Grafana panel as a number of milliseconds or nanoseconds<br />
+        Example: <br />
+        SELECT * FROM demo.test WHERE ts % $__interval_ns = 0<br />
+        Be parsed as: <br />
+        SELECT * FROM demo.test WHERE ts % 250000000 = 0
+        </Card.Description>
+      </Card>
+
       <Card>
         <Card.Heading>$__dateBin</Card.Heading>
         <Card.Description>
@@ -72,13 +83,23 @@ export const QueryHelp = () => (
       <Card>
         <Card.Heading>$__timeFilter(time)</Card.Heading>
         <Card.Description>
-        Represent the range time selected for the Grafana panel<br />
+        Filter a timestamp column on the range time selected for the Grafana panel, including the start and excluding the end<br />
         Example: <br />
         SELECT * from demo.test WHERE $__timeFilter(time) <br />
         Be parsed as: <br />
-        SELECT * from demo.test WHERE time &gt;= &apos;2024-07-30T07:36:07Z&apos; AND time &lt;= &apos;2024-07-30T10:36:07Z&apos; <br />
-        Equal to: <br />
-        SELECT * from demo.test WHERE time &gt;= $timeFrom AND time &lt;= $__timeTo
+        SELECT * from demo.test WHERE time &gt;= cast(&apos;2024-07-30T07:36:07.123Z&apos; as timestamp) AND time &lt; cast(&apos;2024-07-30T10:36:07.456Z&apos; as timestamp)
+        </Card.Description>
+      </Card>
+
+      <Card>
+        <Card.Heading>$__unixEpochFilter(ts)</Card.Heading>
+        <Card.Description>
+        Filter an integer column holding Unix epoch seconds on the range time selected for the Grafana panel.
+        $__unixEpochMsFilter(ts) and $__unixEpochNanoFilter(ts) do the same for milliseconds and nanoseconds<br />
+        Example: <br />
+        SELECT * from demo.test WHERE $__unixEpochFilter(ts) <br />
+        Be parsed as: <br />
+        SELECT * from demo.test WHERE ts &gt;= 1722325068 AND ts &lt; 1722335768
         </Card.Description>
       </Card>
 
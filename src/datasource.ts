@@ -1,18 +1,60 @@
-import { DataQueryResponse, MetricFindValue, DataSourceInstanceSettings, CoreApp, ScopedVars, VariableWithMultiSupport } from '@grafana/data'
-import { frameToMetricFindValue, DataSourceWithBackend, getTemplateSrv } from '@grafana/runtime'
+import { AnnotationQuery, DataQueryRequest, DataQueryResponse, LiveChannelScope, MetricFindValue, DataSourceInstanceSettings, CoreApp, ScopedVars, VariableWithMultiSupport } from '@grafana/data'
+import { frameToMetricFindValue, DataSourceWithBackend, getGrafanaLiveSrv, getTemplateSrv } from '@grafana/runtime'
 import { SQLQuery, FlightSQLDataSourceOptions, DEFAULT_QUERY } from './types'
+import { AnnotationQueryEditor } from './components/AnnotationQueryEditor'
 
-import { lastValueFrom } from 'rxjs';
+import { lastValueFrom, merge, Observable } from 'rxjs';
+
+// METRIC_FIND_REF_ID is the refId of variable queries.
+const METRIC_FIND_REF_ID = 'metricFindQuery'
 
 export class FlightSQLDataSource extends DataSourceWithBackend<SQLQuery, FlightSQLDataSourceOptions> {
+  adhocFiltersTable?: string
+
   constructor(instanceSettings: DataSourceInstanceSettings<FlightSQLDataSourceOptions>) {
     super(instanceSettings)
+    this.adhocFiltersTable = instanceSettings.jsonData.adhocFiltersTable
+    this.annotations = {
+      prepareQuery(anno: AnnotationQuery<SQLQuery>): SQLQuery | undefined {
+        if (!anno.target) {
+          return undefined
+        }
+        return {...anno.target, queryType: 'annotations', format: 'table'}
+      },
+      QueryEditor: AnnotationQueryEditor,
+    }
   }
 
+  query(request: DataQueryRequest<SQLQuery>): Observable<DataQueryResponse> {
+    const streams = request.targets.filter((t) => t.stream && !t.hide)
+    if (!streams.length) {
+      return super.query(request)
+    }
+    const observables = streams.map((t) => this.streamQuery(t, request.scopedVars))
+    const targets = request.targets.filter((t) => !t.stream)
+    if (targets.length) {
+      observables.push(super.query({...request, targets}))
+    }
+    return merge(...observables)
+  }
+
+  // streamQuery subscribes to a Grafana Live channel that pushes the new rows of a query.
+  streamQuery(target: SQLQuery, scopedVars: ScopedVars): Observable<DataQueryResponse> {
+    const data = this.applyTemplateVariables(target, scopedVars)
+    return getGrafanaLiveSrv().getDataStream({
+      key: target.refId,
+      addr: {
+        scope: LiveChannelScope.DataSource,
+        namespace: this.uid,
+        path: `stream/${hashString(JSON.stringify(data))}`,
+        data,
+      },
+    })
+  }
 
 async metricFindQuery(queryText: string, options?: any): Promise<MetricFindValue[]> {
   const target: SQLQuery = {
-    refId: 'metricFindQuery',
+    refId: METRIC_FIND_REF_ID,
     queryText,
     rawEditor: true,
     format: 'table'
@@ -98,6 +140,8 @@ toMetricFindValue(rsp: DataQueryResponse): MetricFindValue[] {
     const interpolatedQuery: SQLQuery = {
       ...query,
       queryText: getTemplateSrv().replace(query.queryText, scopedVars, this.interpolateVariable),
+      // Variable queries list values and are not filtered by the dashboard's ad-hoc filters.
+      adhocFilters: query.refId === METRIC_FIND_REF_ID ? [] : (getTemplateSrv() as any).getAdhocFilters?.(this.name) ?? [],
     }
     return interpolatedQuery
   }
@@ -114,7 +158,32 @@ toMetricFindValue(rsp: DataQueryResponse): MetricFindValue[] {
     return this.getResource(`/flightsql/columns?table=${table}`)
   }
 
+  async getTagKeys(): Promise<MetricFindValue[]> {
+    if (!this.adhocFiltersTable) {
+      return []
+    }
+    const res = await this.getResource('/flightsql/tag-keys', {table: this.adhocFiltersTable})
+    return res.tagKeys.map((k: string) => ({text: k}))
+  }
+
+  async getTagValues(options: {key: string}): Promise<MetricFindValue[]> {
+    if (!this.adhocFiltersTable) {
+      return []
+    }
+    const res = await this.getResource('/flightsql/tag-values', {table: this.adhocFiltersTable, key: options.key})
+    return res.tagValues.map((v: string) => ({text: v}))
+  }
+
   getMacros(): Promise<any> {
     return this.getResource('/plugin/macros')
   }
 }
+
+// hashString returns a short, stable hash of a string for use in channel paths.
+function hashString(s: string): string {
+  let h = 0
+  for (let i = 0; i < s.length; i++) {
+    h = (Math.imul(31, h) + s.charCodeAt(i)) | 0
+  }
+  return (h >>> 0).toString(16)
+}
@@ -4,13 +4,43 @@ import {formatSQL} from './components/sqlFormatter'
 export interface SQLQuery extends DataQuery {
   queryText?: string
   format?: string
+  timeSeriesOutput?: string
+  alias?: string
+  downsample?: string
+  splitDuration?: string
+  incrementalCache?: boolean
+  incrementalOverlap?: string
+  stream?: boolean
+  streamInterval?: string
+  streamMode?: string
+  annotationMapping?: AnnotationMapping
+  adhocFilters?: AdhocFilter[]
   rawEditor?: boolean
+  splitStatements?: boolean
+  database?: string
+  headers?: Record<string, string>
   table?: string
+  dbSchema?: string
   columns?: string[]
   wheres?: string[]
   orderBy?: string
   groupBy?: string
   limit?: string
+  timeColumn?: string
+}
+
+export interface AnnotationMapping {
+  time?: string
+  timeEnd?: string
+  text?: string
+  title?: string
+  tags?: string
+}
+
+export interface AdhocFilter {
+  key: string
+  operator: string
+  value: string
 }
 
 export const DEFAULT_QUERY: Partial<SQLQuery> = {}
@@ -26,6 +56,16 @@ export interface FlightSQLDataSourceOptions extends DataSourceJsonData {
   password?: string
   selectedAuthType?: string
   metadata?: any
+  adhocFiltersTable?: string
+  overridableHeaders?: string[]
+  maxConcurrentQueries?: number
+  memoryLimitMB?: number
+  conversionWorkers?: number
+  readOnly?: boolean
+  auditLog?: boolean
+  auditSampleRate?: number
+  auditRedactLiterals?: boolean
+  slowQueryThreshold?: string
 }
 
 export interface SecureJsonData {
@@ -62,3 +102,26 @@ export const QUERY_FORMAT_OPTIONS = [
   {label: 'Time series', value: QueryFormat.Timeseries},
   {label: 'Table', value: QueryFormat.Table},
 ]
+
+export enum TimeSeriesOutput {
+  Wide = 'wide',
+  Multi = 'multi',
+  Long = 'long',
+}
+
+export const TIME_SERIES_OUTPUT_OPTIONS = [
+  {label: 'Wide', value: TimeSeriesOutput.Wide},
+  {label: 'Multi-frame', value: TimeSeriesOutput.Multi},
+  {label: 'Long', value: TimeSeriesOutput.Long},
+]
+
+export const DOWNSAMPLE_OPTIONS = [
+  {label: 'None', value: ''},
+  {label: 'LTTB', value: 'lttb'},
+  {label: 'Min/Max', value: 'minmax'},
+]
+
+export const STREAM_MODE_OPTIONS = [
+  {label: 'Tail', value: 'tail', description: 'Query from the latest time seen up to now'},
+  {label: 'Poll', value: 'poll', description: 'Rerun the query and drop rows already sent'},
+]